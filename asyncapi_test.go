@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
@@ -77,7 +78,11 @@ func TestAsyncApi(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		cmd = exec.Command("mv", "support.go", "app/src")
+		files, err := filepath.Glob("*.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd = exec.Command("mv", append(files, "app/src")...)
 		err = cmd.Run()
 		if err != nil {
 			t.Fatal(err)
@@ -110,8 +115,11 @@ func TestAsyncApi(t *testing.T) {
 		"examples/http/asyncapi_secure.yml",
 		"examples/kafka/asyncapi.yml",
 		"examples/kafka/asyncapi_secure.yml",
+		"examples/avro/asyncapi.yml",
+		"examples/protobuf/asyncapi.yml",
 		"examples/mqtt/asyncapi.yml",
 		"examples/mqtt/asyncapi_secure.yml",
+		"examples/mqtt5/asyncapi.yml",
 		"examples/websocket/asyncapi.yml",
 		"examples/websocket/asyncapi_secure.yml",
 		"examples/streetlights/streetlights.yml",
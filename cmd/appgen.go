@@ -8,20 +8,40 @@ import (
 )
 
 func init() {
-	appgen.Flags().StringVarP(&input, "input", "i", "asyncapi.yml", "path to input swagger file")
-	appgen.Flags().StringVarP(&conversionType, "type", "t", "flogoapiapp", "conversion type like flogoapiapp or flogodescriptor")
-	appgen.Flags().StringVarP(&role, "role", "r", "server", "server or client; defaults to server")
+	appgen.Flags().StringVarP(&input, "input", "i", "asyncapi.yml", "path to input async api file, or comma separated files merged into one application")
+	appgen.Flags().StringVarP(&conversionType, "type", "t", "flogoapiapp", "conversion type like flogoapiapp, flogodescriptor, flogomodule or goclient")
+	appgen.Flags().StringVarP(&role, "role", "r", "server", "server, client or both of the servers without x-flogo-role; defaults to server")
 	appgen.Flags().StringVarP(&output, "output", "o", ".", "path to generated file")
+	appgen.Flags().StringVarP(&destination, "destination", "d", "", "channel to destination rules like separator=.,prefix=acme.,case=lower,template={channel}")
+	appgen.Flags().StringVarP(&deadLetter, "deadletter", "l", "", "retry and dead-letter rules of the channels like destination={destination}.dlq,retries=3,backoff=1s")
+	appgen.Flags().StringVarP(&versions, "versions", "v", "", "version lock file with a module and its version per line")
+	appgen.Flags().StringSliceVar(&overlays, "overlays", nil, "comma separated overlay documents applied in order to the spec")
+	appgen.Flags().StringVarP(&config, "config", "c", "", "generator config file; defaults to "+transform.ConfigFile+" if it exists")
 	common.RegisterPlugin(appgen)
 }
 
-var input, conversionType, role, output string
+var input, conversionType, role, output, destination, deadLetter, versions, config string
+var overlays []string
 var appgen = &cobra.Command{
 	Use:              "asyncapi",
 	Short:            "generates flogo app",
 	Long:             "generates flogo application for supplied async api specification",
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
 	Run: func(cmd *cobra.Command, args []string) {
-		transform.Transform(input, output, conversionType, role)
+		flags := transform.Config{Overlays: overlays}
+		for name, value := range map[string]*string{
+			"input":       &flags.Input,
+			"type":        &flags.Type,
+			"role":        &flags.Role,
+			"output":      &flags.Output,
+			"destination": &flags.Destination,
+			"deadletter":  &flags.DeadLetter,
+			"versions":    &flags.Versions,
+		} {
+			if cmd.Flags().Changed(name) {
+				*value, _ = cmd.Flags().GetString(name)
+			}
+		}
+		transform.TransformConfig(transform.LoadConfig(config).Merge(flags))
 	},
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+func main() {
+	startRegistry()
+}
+
+// registry is an in memory stand-in for a confluent schema registry
+type registry struct {
+	sync.Mutex
+	schemas []string
+}
+
+// startRegistry starts the schema registry on localhost:8081
+func startRegistry() {
+	r := &registry{}
+	middleware := http.NewServeMux()
+	middleware.HandleFunc("/subjects/", r.register)
+	middleware.HandleFunc("/schemas/ids/", r.lookup)
+	server := http.Server{
+		Addr:    "localhost:8081",
+		Handler: middleware,
+	}
+	fmt.Println("Starting schema registry at http://localhost:8081")
+	log.Fatal(server.ListenAndServe())
+}
+
+// register handles POST /subjects/<subject>/versions
+func (r *registry) register(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/versions") {
+		http.NotFound(w, req)
+		return
+	}
+	body := struct {
+		Schema string `json:"schema"`
+	}{}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Lock()
+	id := 0
+	for i, schema := range r.schemas {
+		if schema == body.Schema {
+			id = i + 1
+			break
+		}
+	}
+	if id == 0 {
+		r.schemas = append(r.schemas, body.Schema)
+		id = len(r.schemas)
+	}
+	r.Unlock()
+	fmt.Println("registered schema", id, "for", req.URL.Path)
+	json.NewEncoder(w).Encode(map[string]int{"id": id})
+}
+
+// lookup handles GET /schemas/ids/<id>
+func (r *registry) lookup(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/schemas/ids/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	if id < 1 || id > len(r.schemas) {
+		http.NotFound(w, req)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"schema": r.schemas[id-1]})
+}
@@ -13,10 +13,10 @@ func main() {
 	startServer()
 }
 
-// startServer starts echo websocket server on localhost:8080/ws
+// startServer starts echo websocket server on localhost:8000/ws/
 func startServer() {
 	middleware := http.NewServeMux()
-	middleware.HandleFunc("/ws", wsHandler)
+	middleware.HandleFunc("/ws/", wsHandler)
 	server := http.Server{
 		Addr:    "localhost:8000",
 		Handler: middleware,
@@ -38,9 +38,19 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 		clientAdd := conn.RemoteAddr()
 		fmt.Println("Upgraded to websocket protocol")
 		fmt.Println("Remote address:", clientAdd)
+		fmt.Println("Path:", r.URL.Path)
 
+		go func() {
+			for {
+				_, message, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				fmt.Println("received message", string(message))
+			}
+		}()
 		for {
-			conn.WriteMessage(websocket.TextMessage, []byte(`{"message": "hello world"}`))
+			err = conn.WriteMessage(websocket.TextMessage, []byte(`{"message": "hello world"}`))
 			if err != nil {
 				fmt.Println("write error", err)
 				break
@@ -4,12 +4,14 @@ go 1.12
 
 require (
 	github.com/asyncapi/parser v0.0.0-20190916122344-ef6526d42c40
+	github.com/bufbuild/protocompile v0.6.0
 	github.com/ghodss/yaml v1.0.0 // indirect
-	github.com/google/go-cmp v0.2.0 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/project-flogo/cli v0.9.0-rc.2
 	github.com/project-flogo/core v0.9.3-0.20190610180641-336db421a17a
 	github.com/project-flogo/microgateway v0.0.0-20190708190753-c54f135979ec
 	github.com/spf13/cobra v0.0.3
+	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v3 v3.0.1
 	gotest.tools v2.2.0+incompatible // indirect
 )
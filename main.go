@@ -2,16 +2,43 @@ package main
 
 import (
 	"flag"
+	"strings"
 
 	"github.com/project-flogo/asyncapi/transform"
 )
 
 func main() {
-	input := flag.String("input", "asyncapi.yml", "input async api file")
-	conversionType := flag.String("type", "flogoapiapp", "conversion type like flogoapiapp or flogodescriptor")
-	role := flag.String("role", "server", "server or client; defaults to server")
+	input := flag.String("input", "asyncapi.yml", "input async api file, or comma separated files merged into one application")
+	conversionType := flag.String("type", "flogoapiapp", "conversion type like flogoapiapp, flogodescriptor, flogomodule or goclient")
+	role := flag.String("role", "server", "server, client or both of the servers without x-flogo-role; defaults to server")
 	output := flag.String("output", ".", "path to store generated file")
+	destination := flag.String("destination", "", "channel to destination rules like separator=.,prefix=acme.,case=lower,template={channel}")
+	deadLetter := flag.String("deadletter", "", "retry and dead-letter rules of the channels like destination={destination}.dlq,retries=3,backoff=1s")
+	versions := flag.String("versions", "", "version lock file with a module and its version per line")
+	overlays := flag.String("overlays", "", "comma separated overlay documents applied in order to the spec")
+	config := flag.String("config", "", "generator config file; defaults to "+transform.ConfigFile+" if it exists")
 
 	flag.Parse()
-	transform.Transform(*input, *output, *conversionType, *role)
+	flags := transform.Config{}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "input":
+			flags.Input = *input
+		case "type":
+			flags.Type = *conversionType
+		case "role":
+			flags.Role = *role
+		case "output":
+			flags.Output = *output
+		case "destination":
+			flags.Destination = *destination
+		case "deadletter":
+			flags.DeadLetter = *deadLetter
+		case "versions":
+			flags.Versions = *versions
+		case "overlays":
+			flags.Overlays = strings.Split(*overlays, ",")
+		}
+	})
+	transform.TransformConfig(transform.LoadConfig(*config).Merge(flags))
 }
@@ -0,0 +1,486 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// isAvro returns true if the schema format is an avro schema
+func isAvro(schemaFormat string) bool {
+	return strings.HasPrefix(strings.ToLower(schemaFormat), "application/vnd.apache.avro")
+}
+
+// goName converts an avro name to an exported go name
+func goName(name string) string {
+	if index := strings.LastIndex(name, "."); index >= 0 {
+		name = name[index+1:]
+	}
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	converted := ""
+	for _, part := range parts {
+		converted += strings.ToUpper(part[:1]) + part[1:]
+	}
+	if converted == "" || unicode.IsDigit(rune(converted[0])) {
+		converted = "X" + converted
+	}
+	return converted
+}
+
+// avroGoType returns the go type of an avro schema, the go types of named records are written to the support code
+func avroGoType(support *supportCode, schema interface{}) string {
+	switch schema := schema.(type) {
+	case string:
+		switch schema {
+		case "null":
+			return "interface{}"
+		case "boolean":
+			return "bool"
+		case "int":
+			return "int32"
+		case "long":
+			return "int64"
+		case "float":
+			return "float32"
+		case "double":
+			return "float64"
+		case "bytes":
+			return "[]byte"
+		case "string":
+			return "string"
+		}
+		return goName(schema)
+	case []interface{}:
+		nullable, members := false, make([]interface{}, 0, len(schema))
+		for _, member := range schema {
+			if member == "null" {
+				nullable = true
+				continue
+			}
+			members = append(members, member)
+		}
+		if len(members) != 1 {
+			return "interface{}"
+		}
+		typ := avroGoType(support, members[0])
+		if nullable && !strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map[") && typ != "interface{}" {
+			typ = "*" + typ
+		}
+		return typ
+	case map[string]interface{}:
+		switch logicalType, _ := schema["logicalType"].(string); logicalType {
+		case "date", "timestamp-millis", "timestamp-micros":
+			support.addImport("time")
+			return "time.Time"
+		case "decimal":
+			return "interface{}"
+		}
+		switch typ := schema["type"].(type) {
+		case string:
+			switch typ {
+			case "record", "error":
+				return avroRecord(support, schema)
+			case "enum":
+				return "string"
+			case "fixed":
+				return "[]byte"
+			case "array":
+				return "[]" + avroGoType(support, schema["items"])
+			case "map":
+				return "map[string]" + avroGoType(support, schema["values"])
+			}
+			return avroGoType(support, typ)
+		default:
+			return avroGoType(support, typ)
+		}
+	}
+	return "interface{}"
+}
+
+// avroRecord writes the go struct of an avro record
+func avroRecord(support *supportCode, schema map[string]interface{}) string {
+	name, _ := schema["name"].(string)
+	typ := goName(name)
+	if !support.once("type:" + typ) {
+		return typ
+	}
+	record := bytes.Buffer{}
+	fmt.Fprintf(&record, "type %s struct {\n", typ)
+	fields, _ := schema["fields"].([]interface{})
+	for _, value := range fields {
+		field, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := field["name"].(string)
+		fmt.Fprintf(&record, "\t%s %s `json:%q`\n", goName(name), avroGoType(support, field["type"]), name)
+	}
+	fmt.Fprintf(&record, "}\n")
+	fmt.Fprintf(&record, "func Decode%s(message interface{}) (*%s, error) {\n", typ, typ)
+	fmt.Fprintf(&record, "\tvalue := &%s{}\n", typ)
+	fmt.Fprintf(&record, "\treturn value, convertMessage(message, value)\n")
+	fmt.Fprintf(&record, "}\n")
+	support.Write(record.Bytes())
+	return typ
+}
+
+// avroSchema returns the avro schema of the message payload
+func avroSchema(s settings) interface{} {
+	payload := s.message["payload"]
+	if value, ok := payload.(string); ok {
+		err := json.Unmarshal([]byte(value), &payload)
+		if err != nil {
+			panic(fmt.Errorf("invalid avro schema of channel %s: %v", s.topic, err))
+		}
+	}
+	return payload
+}
+
+// writeAvroCodec writes the go types of the avro payload and registers its codec
+func writeAvroCodec(support *supportCode, name string, s settings) {
+	payload := avroSchema(s)
+	schema, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+
+	support.addImport("bytes")
+	support.addImport("encoding/binary")
+	support.addImport("encoding/json")
+	support.addImport("fmt")
+	support.addImport("net/http")
+	support.addImport("strings")
+	support.addImport("sync")
+	support.addImport("github.com/linkedin/goavro/v2")
+	support.writeOnce("avro", avroSupport)
+	avroGoType(support, payload)
+
+	registry := ""
+	if value, ok := s.extensions["x-schema-registry"].(string); ok {
+		registry = value
+	}
+	fmt.Fprintf(support, "func init() {\n")
+	fmt.Fprintf(support, "\tregisterAvro(%q, %q, %q, %q)\n", name, schema, registry, s.destination+"-value")
+	fmt.Fprintf(support, "}\n")
+}
+
+const avroSupport = `type avroCodec struct {
+	codec      *goavro.Codec
+	schema     interface{}
+	names      map[string]interface{}
+	registry   string
+	subject    string
+	mutex      sync.Mutex
+	id         uint32
+	registered bool
+	schemas    map[uint32]*goavro.Codec
+}
+func registerAvro(name, schema, registry, subject string) {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		panic(err)
+	}
+	avro := &avroCodec{
+		codec:    codec,
+		names:    make(map[string]interface{}),
+		registry: strings.TrimSuffix(registry, "/"),
+		subject:  subject,
+		schemas:  make(map[uint32]*goavro.Codec),
+	}
+	if err := json.Unmarshal([]byte(schema), &avro.schema); err != nil {
+		panic(err)
+	}
+	avro.index(avro.schema, "")
+	schemaCodecs[name] = avro
+}
+func (a *avroCodec) index(schema interface{}, namespace string) {
+	switch schema := schema.(type) {
+	case []interface{}:
+		for _, member := range schema {
+			a.index(member, namespace)
+		}
+	case map[string]interface{}:
+		if name, ok := schema["name"].(string); ok {
+			if value, ok := schema["namespace"].(string); ok {
+				namespace = value
+			}
+			if !strings.Contains(name, ".") && namespace != "" {
+				schema["name"] = namespace + "." + name
+			}
+			a.names[name], a.names[schema["name"].(string)] = schema, schema
+		}
+		if fields, ok := schema["fields"].([]interface{}); ok {
+			for _, field := range fields {
+				if field, ok := field.(map[string]interface{}); ok {
+					a.index(field["type"], namespace)
+				}
+			}
+		}
+		a.index(schema["type"], namespace)
+		a.index(schema["items"], namespace)
+		a.index(schema["values"], namespace)
+	}
+}
+func (a *avroCodec) resolve(schema interface{}) interface{} {
+	if name, ok := schema.(string); ok {
+		if named, ok := a.names[name]; ok {
+			return named
+		}
+	}
+	return schema
+}
+func (a *avroCodec) typeName(schema interface{}) string {
+	switch schema := a.resolve(schema).(type) {
+	case string:
+		return schema
+	case map[string]interface{}:
+		if name, ok := schema["name"].(string); ok {
+			return name
+		}
+		typ := a.typ(schema)
+		if logicalType, ok := schema["logicalType"].(string); ok {
+			return typ + "." + logicalType
+		}
+		return typ
+	}
+	return ""
+}
+func (a *avroCodec) typ(schema interface{}) string {
+	switch schema := a.resolve(schema).(type) {
+	case string:
+		return schema
+	case map[string]interface{}:
+		return a.typ(schema["type"])
+	}
+	return ""
+}
+func (a *avroCodec) fits(schema, value interface{}) bool {
+	typ := a.typ(schema)
+	switch value.(type) {
+	case nil:
+		return typ == "null"
+	case bool:
+		return typ == "boolean"
+	case string:
+		return typ == "string" || typ == "enum"
+	case float64, float32, int, int32, int64:
+		return typ == "int" || typ == "long" || typ == "float" || typ == "double"
+	case []byte:
+		return typ == "bytes" || typ == "fixed"
+	case []interface{}:
+		return typ == "array"
+	case map[string]interface{}:
+		return typ == "record" || typ == "error" || typ == "map"
+	}
+	return false
+}
+func (a *avroCodec) unwrap(schema, value interface{}) interface{} {
+	switch schema := a.resolve(schema).(type) {
+	case []interface{}:
+		union, ok := value.(map[string]interface{})
+		if !ok || len(union) != 1 {
+			return value
+		}
+		for name, member := range union {
+			for _, candidate := range schema {
+				if a.typeName(candidate) == name {
+					return a.unwrap(candidate, member)
+				}
+			}
+			return member
+		}
+	case map[string]interface{}:
+		switch schema["type"] {
+		case "record", "error":
+			if record, ok := value.(map[string]interface{}); ok {
+				fields, _ := schema["fields"].([]interface{})
+				for _, field := range fields {
+					field, _ := field.(map[string]interface{})
+					name, _ := field["name"].(string)
+					if member, ok := record[name]; ok {
+						record[name] = a.unwrap(field["type"], member)
+					}
+				}
+			}
+		case "array":
+			if items, ok := value.([]interface{}); ok {
+				for i, item := range items {
+					items[i] = a.unwrap(schema["items"], item)
+				}
+			}
+		case "map":
+			if values, ok := value.(map[string]interface{}); ok {
+				for key, member := range values {
+					values[key] = a.unwrap(schema["values"], member)
+				}
+			}
+		default:
+			if _, ok := schema["type"].(string); !ok {
+				return a.unwrap(schema["type"], value)
+			}
+		}
+	}
+	return value
+}
+func (a *avroCodec) wrap(schema, value interface{}) interface{} {
+	switch schema := a.resolve(schema).(type) {
+	case []interface{}:
+		if value == nil {
+			return nil
+		}
+		if union, ok := value.(map[string]interface{}); ok && len(union) == 1 {
+			for name := range union {
+				for _, candidate := range schema {
+					if a.typeName(candidate) == name {
+						return value
+					}
+				}
+			}
+		}
+		for _, candidate := range schema {
+			if a.fits(candidate, value) {
+				return map[string]interface{}{a.typeName(candidate): a.wrap(candidate, value)}
+			}
+		}
+	case map[string]interface{}:
+		switch schema["type"] {
+		case "record", "error":
+			if record, ok := value.(map[string]interface{}); ok {
+				wrapped := make(map[string]interface{}, len(record))
+				fields, _ := schema["fields"].([]interface{})
+				for _, field := range fields {
+					field, _ := field.(map[string]interface{})
+					name, _ := field["name"].(string)
+					if member, ok := record[name]; ok {
+						wrapped[name] = a.wrap(field["type"], member)
+					}
+				}
+				return wrapped
+			}
+		case "array":
+			if items, ok := value.([]interface{}); ok {
+				wrapped := make([]interface{}, len(items))
+				for i, item := range items {
+					wrapped[i] = a.wrap(schema["items"], item)
+				}
+				return wrapped
+			}
+		case "map":
+			if values, ok := value.(map[string]interface{}); ok {
+				wrapped := make(map[string]interface{}, len(values))
+				for key, member := range values {
+					wrapped[key] = a.wrap(schema["values"], member)
+				}
+				return wrapped
+			}
+		default:
+			if _, ok := schema["type"].(string); !ok {
+				return a.wrap(schema["type"], value)
+			}
+		}
+	}
+	return value
+}
+func (a *avroCodec) lookup(id uint32) (*goavro.Codec, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if codec, ok := a.schemas[id]; ok {
+		return codec, nil
+	}
+	response, err := http.Get(fmt.Sprintf("%s/schemas/ids/%d", a.registry, id))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("schema %d not found: %s", id, response.Status)
+	}
+	body := struct {
+		Schema string ` + "`json:\"schema\"`" + `
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	codec, err := goavro.NewCodec(body.Schema)
+	if err != nil {
+		return nil, err
+	}
+	a.schemas[id] = codec
+	return codec, nil
+}
+func (a *avroCodec) register() (uint32, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.registered {
+		return a.id, nil
+	}
+	schema, err := json.Marshal(map[string]string{"schema": a.codec.Schema()})
+	if err != nil {
+		return 0, err
+	}
+	url := fmt.Sprintf("%s/subjects/%s/versions", a.registry, a.subject)
+	response, err := http.Post(url, "application/vnd.schemaregistry.v1+json", bytes.NewReader(schema))
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("schema of %s not registered: %s", a.subject, response.Status)
+	}
+	body := struct {
+		ID uint32 ` + "`json:\"id\"`" + `
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return 0, err
+	}
+	a.id, a.registered = body.ID, true
+	return a.id, nil
+}
+func (a *avroCodec) decode(data []byte) (interface{}, error) {
+	codec := a.codec
+	if a.registry != "" && len(data) > 5 && data[0] == 0 {
+		var err error
+		codec, err = a.lookup(binary.BigEndian.Uint32(data[1:5]))
+		if err != nil {
+			return nil, err
+		}
+		data = data[5:]
+	}
+	native, _, err := codec.NativeFromBinary(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro message: %v", err)
+	}
+	return a.unwrap(a.schema, native), nil
+}
+func (a *avroCodec) encode(message interface{}) (interface{}, error) {
+	native := message
+	if _, ok := message.(map[string]interface{}); !ok && message != nil {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		native = nil
+		if err := json.Unmarshal(data, &native); err != nil {
+			return nil, err
+		}
+	}
+	data, err := a.codec.BinaryFromNative(nil, a.wrap(a.schema, native))
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro message: %v", err)
+	}
+	if a.registry != "" {
+		id, err := a.register()
+		if err != nil {
+			return nil, err
+		}
+		header := make([]byte, 5, 5+len(data))
+		binary.BigEndian.PutUint32(header[1:], id)
+		data = append(header, data...)
+	}
+	return string(data), nil
+}
+`
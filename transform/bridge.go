@@ -0,0 +1,229 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/project-flogo/asyncapi/transform/models"
+	"github.com/project-flogo/core/action"
+	"github.com/project-flogo/core/app"
+	"github.com/project-flogo/core/app/resource"
+	"github.com/project-flogo/core/trigger"
+	"github.com/project-flogo/microgateway/api"
+)
+
+const (
+	// defaultPortBase is the port of the first protocol publish bridge
+	defaultPortBase = 9096
+)
+
+// publisher is a publish service of a channel
+type publisher struct {
+	channel string
+	service *api.Service
+	message map[string]interface{}
+	headers []messageHeader
+}
+
+// bridgeConfig configures the ingress that feeds the publish services
+type bridgeConfig struct {
+	ingress  string
+	port     int
+	portBase int
+	interval string
+}
+
+// getBridgeConfig reads the x-publish-bridge extension of the spec
+func getBridgeConfig(model *models.AsyncAPI200Schema) bridgeConfig {
+	config := bridgeConfig{
+		ingress:  "rest",
+		portBase: defaultPortBase,
+		interval: "1m",
+	}
+	value, ok := model.AdditionalProperties["x-publish-bridge"]
+	if !ok {
+		return config
+	}
+	bridge, ok := value.(map[string]interface{})
+	if !ok {
+		return config
+	}
+	if value, ok := bridge["ingress"].(string); ok {
+		config.ingress = value
+	}
+	if value, ok := bridge["port"].(float64); ok {
+		config.port = int(value)
+	}
+	if value, ok := bridge["portBase"].(float64); ok {
+		config.portBase = int(value)
+	}
+	if value, ok := bridge["interval"].(string); ok {
+		config.interval = value
+	}
+	switch config.ingress {
+	case "rest", "timer", "cli", "none":
+	default:
+		panic(fmt.Errorf("invalid publish bridge ingress %s", config.ingress))
+	}
+	return config
+}
+
+// example returns the first example of a message
+func example(message map[string]interface{}) interface{} {
+	if examples, ok := message["examples"].([]interface{}); ok && len(examples) > 0 {
+		return examples[0]
+	}
+	return map[string]interface{}{}
+}
+
+// bridge generates the ingress trigger and the gateway routing messages to the publish services
+func (p protocolConfig) bridge(flogo *app.Config, model *models.AsyncAPI200Schema, publishers []publisher, ports listenPorts, addImport func(path, version string)) {
+	config := getBridgeConfig(model)
+	if config.ingress == "none" {
+		return
+	}
+
+	name, route := fmt.Sprintf("%sPublish", p.name), "/publish"
+	var trig *trigger.Config
+	switch config.ingress {
+	case "rest":
+		addImport("github.com/project-flogo/contrib/trigger/rest", "")
+		id, port := name, config.portBase+p.port-defaultPortBase
+		if config.port != 0 {
+			// the protocols sharing the trigger have their own routes
+			id, port, route = "publish", config.port, "/publish/"+p.name
+		}
+		if p.loopback {
+			// the client side of a loopback app has its own bridges
+			if config.port != 0 {
+				id = "publishClient"
+			}
+		}
+		for _, existing := range flogo.Triggers {
+			if existing.Id == id {
+				trig = existing
+				break
+			}
+		}
+		if trig == nil {
+			trig = &trigger.Config{
+				Id:  id,
+				Ref: "github.com/project-flogo/contrib/trigger/rest",
+				Settings: map[string]interface{}{
+					"port": ports.listen(port, id, p.loopback),
+				},
+			}
+			flogo.Triggers = append(flogo.Triggers, trig)
+		}
+	case "timer":
+		addImport("github.com/project-flogo/contrib/trigger/timer", "")
+		trig = &trigger.Config{
+			Id:  name,
+			Ref: "github.com/project-flogo/contrib/trigger/timer",
+		}
+		flogo.Triggers = append(flogo.Triggers, trig)
+	case "cli":
+		addImport("github.com/project-flogo/contrib/trigger/cli", "")
+		trig = &trigger.Config{
+			Id:  name,
+			Ref: "github.com/project-flogo/contrib/trigger/cli",
+		}
+		flogo.Triggers = append(flogo.Triggers, trig)
+	}
+
+	gateway := &api.Microgateway{
+		Name: name,
+	}
+	addImport("github.com/project-flogo/contrib/activity/log", "")
+	service := &api.Service{
+		Name:        "log",
+		Ref:         "github.com/project-flogo/contrib/activity/log",
+		Description: "logging service",
+	}
+	gateway.Services = append(gateway.Services, service)
+	step := &api.Step{
+		Service: "log",
+		Input: map[string]interface{}{
+			"message": "=$.payload.message",
+		},
+	}
+	gateway.Steps = append(gateway.Steps, step)
+	addImport("github.com/nareshkumarthota/flogocomponents/activity/methodinvoker", "")
+	message := addMethodStep(gateway, "encode", "encode the message", fmt.Sprintf("%sEncode", p.name), "=$.payload")
+	headers := ""
+	for _, publisher := range publishers {
+		if len(publisher.headers) > 0 {
+			headers = addMethodStep(gateway, "headers", "set the message headers", fmt.Sprintf("%sPublishHeaders", p.name), message)
+			break
+		}
+	}
+
+	addImport("github.com/project-flogo/microgateway@%s", MicrogatewayVersion)
+	for _, publisher := range publishers {
+		handler := trigger.HandlerConfig{}
+		input := map[string]interface{}{
+			"channel": fmt.Sprintf("='%s'", publisher.channel),
+		}
+		switch config.ingress {
+		case "rest":
+			handler.Settings = map[string]interface{}{
+				"method": "POST",
+				"path":   route + colonPath(publisher.channel),
+			}
+			input["message"] = "=$.content"
+			if len(publisher.headers) > 0 {
+				input["headers"] = "=$.headers"
+			}
+		case "timer":
+			handler.Settings = map[string]interface{}{
+				"repeatInterval": config.interval,
+			}
+			input["message"] = example(publisher.message)
+		case "cli":
+			command := strings.Trim(colonPath(publisher.channel), "/")
+			command = strings.NewReplacer("/", "-", ":", "").Replace(command)
+			handler.Settings = map[string]interface{}{
+				"command": fmt.Sprintf("publish-%s", command),
+			}
+			input["message"] = "=$.args"
+		}
+		action := action.Config{
+			Ref: "github.com/project-flogo/microgateway",
+			Settings: map[string]interface{}{
+				"uri":   fmt.Sprintf("microgateway:%s", name),
+				"async": true,
+			},
+		}
+		actionConfig := trigger.ActionConfig{
+			Config: &action,
+			Input:  input,
+		}
+		handler.Actions = append(handler.Actions, &actionConfig)
+		trig.Handlers = append(trig.Handlers, &handler)
+
+		gateway.Services = append(gateway.Services, publisher.service)
+		step := &api.Step{
+			Condition: fmt.Sprintf("$.payload.channel == '%s'", publisher.channel),
+			Service:   publisher.service.Name,
+			Input: map[string]interface{}{
+				p.serviceInput: message + ".message",
+			},
+		}
+		if len(publisher.headers) > 0 {
+			step.Input[p.serviceHeaders] = headers + ".headers"
+		}
+		gateway.Steps = append(gateway.Steps, step)
+	}
+
+	raw, err := json.Marshal(gateway)
+	if err != nil {
+		panic(err)
+	}
+
+	res := &resource.Config{
+		ID:   fmt.Sprintf("microgateway:%s", name),
+		Data: raw,
+	}
+	flogo.Resources = append(flogo.Resources, res)
+}
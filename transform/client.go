@@ -0,0 +1,545 @@
+package transform
+
+import (
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/project-flogo/asyncapi/transform/models"
+)
+
+const (
+	// clientFile is the file of the generated go client
+	clientFile = "client.go"
+)
+
+// clientConfig is the transport of a protocol in the go client
+type clientConfig struct {
+	connect   string
+	imports   []string
+	modules   map[string]string
+	transport string
+}
+
+// supportModules are the versions of the modules the support code and the go client code import
+var supportModules = map[string]string{
+	"github.com/linkedin/goavro/v2": "v2.9.8",
+	"google.golang.org/protobuf":    "v1.27.1",
+}
+
+// clientRoute is the destination of a channel on a server
+type clientRoute struct {
+	server      string
+	destination string
+	codec       string
+}
+
+// clientOperation is a publish or subscribe method of the go client
+type clientOperation struct {
+	name    string
+	channel string
+	typ     string
+	params  []string
+}
+
+// clientCode is the go client of a spec being generated
+type clientCode struct {
+	support    *supportCode
+	modules    map[string]string
+	operations map[string]map[string]clientOperation
+	routes     map[string]map[string][]clientRoute
+	versions   versionLock
+}
+
+// packageName returns the go package name of the client, the title of the spec in lower case letters and digits
+func packageName(model *models.AsyncAPI200Schema) string {
+	name := ""
+	if model.Info != nil {
+		for _, r := range strings.ToLower(model.Info.Title) {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				name += string(r)
+			}
+		}
+	}
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "client" + name
+	}
+	return name
+}
+
+// paramName returns the go argument name of a channel parameter
+func paramName(name string) string {
+	name = goName(name)
+	name = strings.ToLower(name[:1]) + name[1:]
+	switch name {
+	case "ctx", "payload", "handler", "c":
+		return name + "Param"
+	}
+	if token.IsKeyword(name) {
+		return name + "Param"
+	}
+	return name
+}
+
+// operationName returns the go name of an operation, its operationId or the name of its channel
+func operationName(operation *models.Operation, channel string) string {
+	if operation.OperationId != "" {
+		return goName(operation.OperationId)
+	}
+	return goName(strings.TrimPrefix(channel, "/"))
+}
+
+// addOperation adds a publish or subscribe method to the client, the servers sharing a channel share its method
+func (c *clientCode) addOperation(direction string, operation clientOperation, route clientRoute) {
+	if existing, ok := c.operations[direction][operation.name]; ok {
+		if existing.channel != operation.channel {
+			panic(fmt.Errorf("operation %s is declared by channels %s and %s", operation.name, existing.channel, operation.channel))
+		}
+		if existing.typ != operation.typ {
+			panic(fmt.Errorf("operation %s has the payloads %s and %s", operation.name, existing.typ, operation.typ))
+		}
+	}
+	c.operations[direction][operation.name] = operation
+	c.routes[direction][operation.channel] = append(c.routes[direction][operation.channel], route)
+}
+
+// server adds the servers of a protocol to the client with the routes of their channels
+func (c *clientCode) server(p protocolConfig, model *models.AsyncAPI200Schema, serverName string, server *models.Server, o options) {
+	if p.client == nil {
+		fmt.Fprintf(os.Stderr, "warning: the go client doesn't support the %s protocol of server %s\n", p.name, serverName)
+		return
+	}
+	for _, port := range p.client.imports {
+		c.support.addImport(port)
+	}
+	for module, version := range p.client.modules {
+		c.modules[module] = version
+	}
+	c.support.writeOnce("client:"+p.name, p.client.transport)
+
+	url, err := parseServerURL(server.Url)
+	if err != nil {
+		panic(fmt.Errorf("server %s: %v", serverName, err))
+	}
+	variables := make([]string, 0, 8)
+	for _, name := range url.variables() {
+		if server.Variables == nil || server.Variables.AdditionalProperties[name] == nil {
+			panic(fmt.Errorf("server %s: url variable %s is not defined", serverName, name))
+		}
+		variables = append(variables, fmt.Sprintf("%q: %q", name, server.Variables.AdditionalProperties[name].Default))
+	}
+	sort.Strings(variables)
+	fmt.Fprintf(c.support, "func init() {\n")
+	fmt.Fprintf(c.support, "\tclientServers[%q] = clientServer{\n", serverName)
+	fmt.Fprintf(c.support, "\t\tprotocol:  %q,\n", server.Protocol)
+	fmt.Fprintf(c.support, "\t\turl:       %q,\n", server.Url)
+	fmt.Fprintf(c.support, "\t\tvariables: map[string]string{%s},\n", strings.Join(variables, ", "))
+	fmt.Fprintf(c.support, "\t\tconnect:   %s,\n", p.client.connect)
+	fmt.Fprintf(c.support, "\t}\n")
+	fmt.Fprintf(c.support, "}\n")
+	for _, name := range url.variables() {
+		option := "With" + goName(serverName) + goName(name)
+		fmt.Fprintf(c.support, "// %s sets the %s variable of server %s\n", option, name, serverName)
+		fmt.Fprintf(c.support, "func %s(value string) Option {\n", option)
+		fmt.Fprintf(c.support, "\treturn func(o *clientOptions) {\n")
+		fmt.Fprintf(c.support, "\t\to.variables[%q] = value\n", serverName+"."+name)
+		fmt.Fprintf(c.support, "\t}\n")
+		fmt.Fprintf(c.support, "}\n")
+	}
+
+	role := o.serverRole(serverName, server)
+	if role == "both" {
+		// the go client of a loopback app is its client side
+		role = "client"
+	}
+	s := settings{
+		protocolConfig:     p,
+		role:               role,
+		directory:          o.directory,
+		secure:             server.Protocol == p.secure,
+		serverName:         serverName,
+		extensions:         server.AdditionalProperties,
+		defaultContentType: model.DefaultContentType,
+		serverInfo:         bindingsObject(server.Bindings),
+	}
+	if model.Channels == nil {
+		return
+	}
+	names := make([]string, 0, len(model.Channels.AdditionalProperties))
+	for name := range model.Channels.AdditionalProperties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		channel := model.Channels.AdditionalProperties[name]
+		s.parameters = channel.Parameters
+		s.channelInfo = bindingsObject(channel.Bindings)
+		s.topic = "/" + strings.TrimPrefix(name, "/")
+		destination, channelRules := destinationExtension(channel.AdditionalProperties)
+		if destination == "" {
+			destination = p.destination.merge(o.destination).merge(channelRules).destination(s.topic, p.name, serverName)
+		}
+		s.destination = destination
+		subscribe, publish := channel.Subscribe, channel.Publish
+		if s.role == "client" {
+			subscribe, publish = publish, subscribe
+		}
+		params := []string{}
+		for _, parameter := range channelParameters(s) {
+			params = append(params, parameter.name)
+		}
+		for _, direction := range []string{"Subscribe", "Publish"} {
+			operation := subscribe
+			if direction == "Publish" {
+				operation = publish
+			}
+			if operation == nil {
+				continue
+			}
+			s.protocolInfo = operationBindings(operation)
+			s.message = nil
+			messages := operationMessages(operation)
+			if len(messages) > 0 {
+				s.message = messages[0]
+			}
+			coder := "encode"
+			if direction == "Subscribe" {
+				coder = "decode"
+			}
+			method := clientOperation{
+				name:    operationName(operation, s.topic),
+				channel: s.topic,
+				params:  params,
+			}
+			if len(messages) == 1 {
+				typ := method.name + "Payload"
+				if message := s.messageField("name"); message != "" {
+					typ = goName(message)
+				}
+				method.typ = s.payloadType(c.support, typ)
+			}
+			c.addOperation(direction, method, clientRoute{
+				server:      serverName,
+				destination: destination,
+				codec:       s.codec(c.support, coder),
+			})
+		}
+	}
+}
+
+// writeOperations writes the routes of the channels and the publish and subscribe methods of the client
+func (c *clientCode) writeOperations() {
+	for _, direction := range []string{"Publish", "Subscribe"} {
+		channels := make([]string, 0, len(c.routes[direction]))
+		for channel := range c.routes[direction] {
+			channels = append(channels, channel)
+		}
+		sort.Strings(channels)
+		fmt.Fprintf(c.support, "var client%sRoutes = map[string][]clientRoute{\n", direction)
+		for _, channel := range channels {
+			fmt.Fprintf(c.support, "\t%q: {\n", channel)
+			for _, route := range c.routes[direction][channel] {
+				fmt.Fprintf(c.support, "\t\t{server: %q, destination: %q, codec: %q},\n", route.server, route.destination, route.codec)
+			}
+			fmt.Fprintf(c.support, "\t},\n")
+		}
+		fmt.Fprintf(c.support, "}\n")
+
+		names := make([]string, 0, len(c.operations[direction]))
+		for name := range c.operations[direction] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			operation := c.operations[direction][name]
+			args, params := "", make([]string, 0, len(operation.params))
+			for _, param := range operation.params {
+				args += ", " + paramName(param) + " string"
+				params = append(params, fmt.Sprintf("%q: %s", param, paramName(param)))
+			}
+			typ := operation.typ
+			if typ == "" {
+				typ = "interface{}"
+			}
+			if direction == "Publish" {
+				payload := "payload"
+				if operation.typ != "" {
+					payload = "&payload"
+				}
+				fmt.Fprintf(c.support, "// Publish%s publishes a message to channel %s\n", name, operation.channel)
+				fmt.Fprintf(c.support, "func (c *Client) Publish%s(ctx context.Context%s, payload %s) error {\n", name, args, typ)
+				fmt.Fprintf(c.support, "\treturn c.publish(ctx, clientPublishRoutes[%q], map[string]string{%s}, %s)\n",
+					operation.channel, strings.Join(params, ", "), payload)
+				fmt.Fprintf(c.support, "}\n")
+				continue
+			}
+			fmt.Fprintf(c.support, "// Subscribe%s passes the messages of channel %s to the handler until the context is done\n", name, operation.channel)
+			fmt.Fprintf(c.support, "func (c *Client) Subscribe%s(ctx context.Context%s, handler func(ctx context.Context, payload %s) error) error {\n", name, args, typ)
+			fmt.Fprintf(c.support, "\treturn c.subscribe(ctx, clientSubscribeRoutes[%q], map[string]string{%s}, func(ctx context.Context, message interface{}) error {\n",
+				operation.channel, strings.Join(params, ", "))
+			if operation.typ == "" {
+				fmt.Fprintf(c.support, "\t\treturn handler(ctx, message)\n")
+			} else {
+				fmt.Fprintf(c.support, "\t\tpayload, err := Decode%s(message)\n", operation.typ)
+				fmt.Fprintf(c.support, "\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+				fmt.Fprintf(c.support, "\t\treturn handler(ctx, *payload)\n")
+			}
+			fmt.Fprintf(c.support, "\t})\n")
+			fmt.Fprintf(c.support, "}\n")
+		}
+	}
+}
+
+// goMod returns the go.mod of the client with the modules its code imports
+func (c *clientCode) goMod() []byte {
+	for _, port := range c.support.imports {
+		for module, version := range supportModules {
+			if strings.HasPrefix(port, module) {
+				c.modules[module] = version
+			}
+		}
+	}
+	for module, version := range c.modules {
+		c.modules[module] = c.versions.version(module, version)
+	}
+	return goMod(c.support.pkg, c.modules)
+}
+
+// goClient converts a spec to a go client package
+func goClient(input string, o options) *clientCode {
+	o.directory = filepath.Dir(inputFiles(input)[0])
+	model := parse(input, &o)
+
+	c := &clientCode{
+		support: &supportCode{pkg: packageName(&model)},
+		modules: make(map[string]string),
+		operations: map[string]map[string]clientOperation{
+			"Publish":   make(map[string]clientOperation),
+			"Subscribe": make(map[string]clientOperation),
+		},
+		routes: map[string]map[string][]clientRoute{
+			"Publish":   make(map[string][]clientRoute),
+			"Subscribe": make(map[string][]clientRoute),
+		},
+		versions: o.versions,
+	}
+	for _, port := range []string{"bytes", "context", "crypto/tls", "encoding/json", "encoding/xml", "fmt", "io", "sort", "strings"} {
+		c.support.addImport(port)
+	}
+	c.support.writeOnce("client", clientSupport)
+	c.support.writeOnce("codec", codecSupport)
+
+	names := make([]string, 0, len(model.Servers))
+	for name := range model.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		server := model.Servers[name]
+		protocol := server.Protocol
+		for _, config := range configs {
+			if protocol == config.name || protocol == config.secure {
+				c.server(config, &model, name, server, o)
+			}
+		}
+	}
+	c.writeOperations()
+	return c
+}
+
+// ToGoClient converts an async api to a go client package
+func ToGoClient(input, output, role string) {
+	toGoClient(Config{Input: input, Output: output, Role: role})
+}
+
+func toGoClient(config Config) {
+	c := goClient(config.Input, config.options())
+	err := ioutil.WriteFile(filepath.Join(config.Output, layout(config.Layout.Client, clientFile)), c.support.Bytes(), 0644)
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range c.support.files {
+		err := ioutil.WriteFile(filepath.Join(config.Output, name), c.support.code[name].Bytes(), 0644)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(config.Output, "go.mod"), c.goMod(), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+const clientSupport = `type transport interface {
+	publish(ctx context.Context, destination string, message []byte, headers map[string]string) error
+	subscribe(ctx context.Context, destination string, handler func(message []byte, headers map[string]string)) error
+	close() error
+}
+type clientServer struct {
+	protocol  string
+	url       string
+	variables map[string]string
+	connect   func(url string, o *clientOptions) (transport, error)
+}
+type clientRoute struct {
+	server      string
+	destination string
+	codec       string
+}
+var clientServers = make(map[string]clientServer)
+type clientOptions struct {
+	servers   map[string]bool
+	variables map[string]string
+	user      string
+	password  string
+	tls       *tls.Config
+	errors    func(error)
+}
+// Option configures a Client
+type Option func(o *clientOptions)
+// WithServers connects the client to the given servers only, the client connects to all the servers by default
+func WithServers(names ...string) Option {
+	return func(o *clientOptions) {
+		for _, name := range names {
+			o.servers[name] = true
+		}
+	}
+}
+// WithCredentials sets the user and password the client connects to the servers with
+func WithCredentials(user, password string) Option {
+	return func(o *clientOptions) {
+		o.user, o.password = user, password
+	}
+}
+// WithTLS sets the tls configuration the client connects to the servers with, its Certificates serve the https subscriptions
+func WithTLS(config *tls.Config) Option {
+	return func(o *clientOptions) {
+		o.tls = config
+	}
+}
+// WithErrorHandler sets the function receiving the errors of received messages, of their handlers and of the servers receiving them
+func WithErrorHandler(handler func(error)) Option {
+	return func(o *clientOptions) {
+		o.errors = handler
+	}
+}
+// Client publishes and subscribes to the channels of the spec over the protocols of its servers
+type Client struct {
+	options    clientOptions
+	transports map[string]transport
+}
+// New connects a client to the servers of the spec
+func New(options ...Option) (*Client, error) {
+	c := &Client{
+		options: clientOptions{
+			servers:   make(map[string]bool),
+			variables: make(map[string]string),
+		},
+		transports: make(map[string]transport),
+	}
+	for _, option := range options {
+		option(&c.options)
+	}
+	names := make([]string, 0, len(clientServers))
+	for name := range clientServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(c.options.servers) > 0 && !c.options.servers[name] {
+			continue
+		}
+		server := clientServers[name]
+		url := server.url
+		for variable, value := range server.variables {
+			if override, ok := c.options.variables[name+"."+variable]; ok {
+				value = override
+			}
+			url = strings.Replace(url, "{"+variable+"}", value, -1)
+		}
+		transport, err := server.connect(url, &c.options)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("server %s: %v", name, err)
+		}
+		c.transports[name] = transport
+	}
+	return c, nil
+}
+// Close disconnects the client from the servers
+func (c *Client) Close() error {
+	var err error
+	for _, transport := range c.transports {
+		if closeErr := transport.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+func channelDestination(destination string, params map[string]string) string {
+	for name, value := range params {
+		destination = strings.Replace(destination, "{"+name+"}", value, -1)
+	}
+	return destination
+}
+func (c *Client) publish(ctx context.Context, routes []clientRoute, params map[string]string, payload interface{}) error {
+	published := false
+	for _, route := range routes {
+		transport, ok := c.transports[route.server]
+		if !ok {
+			continue
+		}
+		message, err := encodeMessage(route.codec, payload)
+		if err != nil {
+			return err
+		}
+		data, _ := message.(string)
+		if err := transport.publish(ctx, channelDestination(route.destination, params), []byte(data), nil); err != nil {
+			return fmt.Errorf("server %s: %v", route.server, err)
+		}
+		published = true
+	}
+	if !published {
+		return fmt.Errorf("the client isn't connected to a server of the channel")
+	}
+	return nil
+}
+type clientHeadersKey struct{}
+// MessageHeaders returns the headers of a message passed to a subscribe handler
+func MessageHeaders(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(clientHeadersKey{}).(map[string]string)
+	return headers
+}
+func (c *Client) subscribe(ctx context.Context, routes []clientRoute, params map[string]string, handler func(ctx context.Context, message interface{}) error) error {
+	subscribed := false
+	for _, route := range routes {
+		transport, ok := c.transports[route.server]
+		if !ok {
+			continue
+		}
+		codec := route.codec
+		err := transport.subscribe(ctx, channelDestination(route.destination, params), func(data []byte, headers map[string]string) {
+			message, err := decodeMessage(codec, data)
+			if err == nil {
+				err = handler(context.WithValue(ctx, clientHeadersKey{}, headers), message)
+			}
+			if err != nil && c.options.errors != nil {
+				c.options.errors(err)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("server %s: %v", route.server, err)
+		}
+		subscribed = true
+	}
+	if !subscribed {
+		return fmt.Errorf("the client isn't connected to a server of the channel")
+	}
+	return nil
+}
+`
@@ -0,0 +1,289 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// messageField returns a field of the message or of its traits
+func (s settings) messageField(name string) string {
+	if s.message == nil {
+		return ""
+	}
+	if value, ok := s.message[name].(string); ok && value != "" {
+		return value
+	}
+	if traits, ok := s.message["traits"].([]interface{}); ok {
+		for i := len(traits) - 1; i >= 0; i-- {
+			if trait, ok := traits[i].(map[string]interface{}); ok {
+				if value, ok := trait[name].(string); ok && value != "" {
+					return value
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// contentType returns the content type of the message
+func (s settings) contentType() string {
+	if contentType := s.messageField("contentType"); contentType != "" {
+		return contentType
+	}
+	if s.defaultContentType != "" {
+		return s.defaultContentType
+	}
+	return "application/json"
+}
+
+// messageCodec returns the codec used to decode and encode the message
+func (s settings) messageCodec() string {
+	switch schemaFormat := s.messageField("schemaFormat"); {
+	case isAvro(schemaFormat):
+		return "avro"
+	case isProtobuf(schemaFormat):
+		return "protobuf"
+	}
+	contentType := strings.ToLower(s.contentType())
+	if index := strings.Index(contentType, ";"); index >= 0 {
+		contentType = contentType[:index]
+	}
+	contentType = strings.TrimSpace(contentType)
+	switch {
+	case contentType == "application/json" || strings.HasSuffix(contentType, "+json"):
+		return "json"
+	case contentType == "application/xml" || contentType == "text/xml" || strings.HasSuffix(contentType, "+xml"):
+		return "xml"
+	case strings.HasPrefix(contentType, "text/"):
+		return "text"
+	}
+	return "binary"
+}
+
+// codec returns the codec of the message, the schema of schema based codecs is written to the support code
+func (s settings) codec(support *supportCode, direction string) string {
+	codec := s.messageCodec()
+	switch codec {
+	case "avro":
+		name := fmt.Sprintf("avro:%s:%s:%s", s.name, direction, s.topic)
+		writeAvroCodec(support, name, s)
+		return name
+	case "protobuf":
+		name := fmt.Sprintf("proto:%s:%s:%s", s.name, direction, s.topic)
+		writeProtoCodec(support, name, s)
+		return name
+	}
+	return codec
+}
+
+// writeCodec writes the methods decoding and encoding the messages of each channel
+func writeCodec(support *supportCode, name string, decoders, encoders map[string]string) {
+	support.addImport("bytes")
+	support.addImport("encoding/json")
+	support.addImport("encoding/xml")
+	support.addImport("fmt")
+	support.addImport("io")
+	support.addImport("sort")
+	support.addImport("strings")
+	support.writeOnce("codec", codecSupport)
+
+	codecs := func(variable string, codecs map[string]string) {
+		channels := make([]string, 0, len(codecs))
+		for channel := range codecs {
+			channels = append(channels, channel)
+		}
+		sort.Strings(channels)
+		fmt.Fprintf(support, "var %s = map[string]string{\n", variable)
+		for _, channel := range channels {
+			fmt.Fprintf(support, "\t%q: %q,\n", channel, codecs[channel])
+		}
+		fmt.Fprintf(support, "}\n")
+	}
+	codecs(name+"Decoders", decoders)
+	codecs(name+"Encoders", encoders)
+	fmt.Fprintf(support, messageCoder, name, "Decode", "decodeMessage", "Decoders")
+	fmt.Fprintf(support, messageCoder, name, "Encode", "encodeMessage", "Encoders")
+	fmt.Fprintf(support, "func init() {\n")
+	fmt.Fprintf(support, "\tmethodinvoker.RegisterMethods(\"%sDecode\", %sDecode)\n", name, name)
+	fmt.Fprintf(support, "\tmethodinvoker.RegisterMethods(\"%sEncode\", %sEncode)\n", name, name)
+	fmt.Fprintf(support, "}\n")
+}
+
+const messageCoder = `func %[1]s%[2]s(inputs interface{}) (map[string]interface{}, error) {
+	values, _ := inputs.(map[string]interface{})
+	channel, _ := values["channel"].(string)
+	outputs := make(map[string]interface{}, len(values)+2)
+	for key, value := range values {
+		outputs[key] = value
+	}
+	message, err := %[3]s(%[1]s%[4]s[channel], values["message"])
+	if err != nil {
+		outputs["valid"], outputs["error"] = false, err.Error()
+		return outputs, nil
+	}
+	outputs["message"], outputs["valid"] = message, true
+	return outputs, nil
+}
+`
+
+const codecSupport = `type schemaCodec interface {
+	decode(data []byte) (interface{}, error)
+	encode(message interface{}) (interface{}, error)
+}
+var schemaCodecs = make(map[string]schemaCodec)
+func convertMessage(message, value interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+func decodeMessage(codec string, message interface{}) (interface{}, error) {
+	var data []byte
+	switch message := message.(type) {
+	case string:
+		data = []byte(message)
+	case []byte:
+		data = message
+	default:
+		return message, nil
+	}
+	if schema, ok := schemaCodecs[codec]; ok {
+		return schema.decode(data)
+	}
+	switch codec {
+	case "json":
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil, nil
+		}
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, fmt.Errorf("invalid json message: %v", err)
+		}
+		return value, nil
+	case "xml":
+		return decodeXML(data)
+	case "text":
+		return string(data), nil
+	}
+	return data, nil
+}
+func encodeMessage(codec string, message interface{}) (interface{}, error) {
+	switch message := message.(type) {
+	case string:
+		return message, nil
+	case []byte:
+		return string(message), nil
+	}
+	if schema, ok := schemaCodecs[codec]; ok {
+		return schema.encode(message)
+	}
+	switch codec {
+	case "json":
+		data, err := json.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case "xml":
+		elements, ok := message.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("can't encode %T as xml", message)
+		}
+		buffer := bytes.Buffer{}
+		encodeXML(&buffer, "", elements)
+		return buffer.String(), nil
+	case "text":
+		return fmt.Sprint(message), nil
+	}
+	return nil, fmt.Errorf("can't encode %T as %s", message, codec)
+}
+func decodeXML(data []byte) (interface{}, error) {
+	type element struct {
+		name     string
+		children map[string]interface{}
+		text     strings.Builder
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	stack := []*element{{children: make(map[string]interface{})}}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid xml message: %v", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			child := &element{name: token.Name.Local, children: make(map[string]interface{})}
+			for _, attr := range token.Attr {
+				child.children["-"+attr.Name.Local] = attr.Value
+			}
+			stack = append(stack, child)
+		case xml.CharData:
+			stack[len(stack)-1].text.Write(token)
+		case xml.EndElement:
+			child := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			var value interface{} = child.children
+			text := strings.TrimSpace(child.text.String())
+			if len(child.children) == 0 {
+				value = text
+			} else if text != "" {
+				child.children["#text"] = text
+			}
+			parent := stack[len(stack)-1].children
+			switch existing := parent[child.name].(type) {
+			case nil:
+				parent[child.name] = value
+			case []interface{}:
+				parent[child.name] = append(existing, value)
+			default:
+				parent[child.name] = []interface{}{existing, value}
+			}
+		}
+	}
+	return stack[0].children, nil
+}
+func encodeXML(buffer *bytes.Buffer, name string, value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if name != "" {
+			buffer.WriteString("<" + name)
+			for _, key := range keys {
+				if strings.HasPrefix(key, "-") {
+					buffer.WriteString(" " + key[1:] + "=\"")
+					xml.EscapeText(buffer, []byte(fmt.Sprint(value[key])))
+					buffer.WriteString("\"")
+				}
+			}
+			buffer.WriteString(">")
+		}
+		for _, key := range keys {
+			switch {
+			case key == "#text":
+				xml.EscapeText(buffer, []byte(fmt.Sprint(value[key])))
+			case !strings.HasPrefix(key, "-"):
+				encodeXML(buffer, key, value[key])
+			}
+		}
+		if name != "" {
+			buffer.WriteString("</" + name + ">")
+		}
+	case []interface{}:
+		for _, value := range value {
+			encodeXML(buffer, name, value)
+		}
+	default:
+		buffer.WriteString("<" + name + ">")
+		xml.EscapeText(buffer, []byte(fmt.Sprint(value)))
+		buffer.WriteString("</" + name + ">")
+	}
+}
+`
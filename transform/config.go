@@ -0,0 +1,426 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-flogo/asyncapi/transform/models"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the config of the generator read from the working directory if no config is given
+const ConfigFile = "asyncapi-gen.yaml"
+
+// Config configures the generator, the flags override it
+type Config struct {
+	// Input are the comma separated async api files merged into one application
+	Input string `yaml:"input"`
+	// Type is the conversion type like flogoapiapp, flogodescriptor, flogomodule or goclient
+	Type string `yaml:"type"`
+	// Role is the role of the servers without a role, server, client or both
+	Role string `yaml:"role"`
+	// Output is the directory of the generated files
+	Output string `yaml:"output"`
+	// Destination are the channel to destination rules like separator=.,prefix=acme.
+	Destination string `yaml:"destination"`
+	// DeadLetter are the retry and dead-letter rules of the channels like retries=3,backoff=1s
+	DeadLetter string `yaml:"deadletter"`
+	// Versions is the version lock file
+	Versions string `yaml:"versions"`
+	// Overlays are the overlay documents applied in order to the spec
+	Overlays []string `yaml:"overlays"`
+	// Pins are the versions of modules, the version lock overrides them
+	Pins map[string]string `yaml:"pins"`
+	// Layout names the generated files
+	Layout LayoutConfig `yaml:"layout"`
+	// Servers override the servers of the spec by name
+	Servers map[string]ServerConfig `yaml:"servers"`
+	// Protocols override the servers of the spec by protocol
+	Protocols map[string]ProtocolConfig `yaml:"protocols"`
+	// Filters select the servers and channels to generate
+	Filters FilterConfig `yaml:"filters"`
+	// Features toggle the features of the generated code
+	Features FeatureConfig `yaml:"features"`
+}
+
+// LayoutConfig names the generated files
+type LayoutConfig struct {
+	// App is the go file of the flogo application, app.go or main.go for a module
+	App string `yaml:"app"`
+	// Descriptor is the flogo application descriptor, flogo.json
+	Descriptor string `yaml:"descriptor"`
+	// Client is the go file of the go client, client.go
+	Client string `yaml:"client"`
+}
+
+// CredentialsConfig names the environment variables of the credentials of a server
+type CredentialsConfig struct {
+	User       string `yaml:"user"`
+	Password   string `yaml:"password"`
+	TrustStore string `yaml:"trustStore"`
+	CertFile   string `yaml:"certFile"`
+	KeyFile    string `yaml:"keyFile"`
+}
+
+// merge overrides the credentials with the credentials that are set
+func (c CredentialsConfig) merge(credentials CredentialsConfig) CredentialsConfig {
+	if credentials.User != "" {
+		c.User = credentials.User
+	}
+	if credentials.Password != "" {
+		c.Password = credentials.Password
+	}
+	if credentials.TrustStore != "" {
+		c.TrustStore = credentials.TrustStore
+	}
+	if credentials.CertFile != "" {
+		c.CertFile = credentials.CertFile
+	}
+	if credentials.KeyFile != "" {
+		c.KeyFile = credentials.KeyFile
+	}
+	return c
+}
+
+// ProtocolConfig overrides the servers of a protocol
+type ProtocolConfig struct {
+	TriggerVersion  string            `yaml:"triggerVersion"`
+	ActivityVersion string            `yaml:"activityVersion"`
+	Credentials     CredentialsConfig `yaml:"credentials"`
+}
+
+// ServerConfig overrides a server of the spec
+type ServerConfig struct {
+	// Role is the role of the server like x-flogo-role, server, client or both
+	Role string `yaml:"role"`
+	// Protocol replaces the protocol of the server
+	Protocol string `yaml:"protocol"`
+	// URL replaces the url of the server
+	URL             string            `yaml:"url"`
+	TriggerVersion  string            `yaml:"triggerVersion"`
+	ActivityVersion string            `yaml:"activityVersion"`
+	Credentials     CredentialsConfig `yaml:"credentials"`
+	// Extensions are set on the server like the x- extensions of the spec
+	Extensions map[string]interface{} `yaml:"extensions"`
+}
+
+// FilterConfig selects the servers and channels to generate, all of them if empty
+type FilterConfig struct {
+	// Servers are the names of the servers
+	Servers []string `yaml:"servers"`
+	// Channels are patterns of the channel names like light/*
+	Channels []string `yaml:"channels"`
+}
+
+// FeatureConfig toggles the features of the generated code, the x- extensions of the spec are used if unset
+type FeatureConfig struct {
+	// Service generates the service interface like x-service
+	Service *bool `yaml:"service"`
+	// DeadLetters retries the messages of all the channels and publishes them to their dead-letter destination
+	DeadLetters *bool `yaml:"deadLetters"`
+	// Bridge is the ingress of the publish bridge like x-publish-bridge: rest, timer, cli or none
+	Bridge string `yaml:"bridge"`
+}
+
+// defaultCredentials are the environment variables of the credentials if no config names them
+var defaultCredentials = CredentialsConfig{
+	User:       "USER",
+	Password:   "PASSWORD",
+	TrustStore: "TRUST_STORE",
+	CertFile:   "CERT_FILE",
+	KeyFile:    "KEY_FILE",
+}
+
+// LoadConfig reads a config file, the paths of the config are relative to its directory.
+// If the path is empty asyncapi-gen.yaml is read if it exists
+func LoadConfig(file string) Config {
+	config := Config{}
+	if file == "" {
+		if _, err := os.Stat(ConfigFile); err != nil {
+			return config
+		}
+		file = ConfigFile
+	}
+	reader, err := os.Open(file)
+	if err != nil {
+		panic(err)
+	}
+	defer reader.Close()
+	decoder := yaml.NewDecoder(reader)
+	decoder.KnownFields(true)
+	err = decoder.Decode(&config)
+	if err != nil {
+		panic(fmt.Errorf("%s: %v", file, err))
+	}
+	directory := filepath.Dir(file)
+	inputs := []string{}
+	if config.Input != "" {
+		inputs = inputFiles(config.Input)
+	}
+	paths := []*string{&config.Output, &config.Versions}
+	for i := range inputs {
+		paths = append(paths, &inputs[i])
+	}
+	for i := range config.Overlays {
+		paths = append(paths, &config.Overlays[i])
+	}
+	for _, path := range paths {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(directory, *path)
+		}
+	}
+	config.Input = strings.Join(inputs, ",")
+	return config
+}
+
+// Merge returns the config overridden by the fields of the flags that are set
+func (c Config) Merge(flags Config) Config {
+	for _, field := range []struct{ value, flag *string }{
+		{&c.Input, &flags.Input},
+		{&c.Type, &flags.Type},
+		{&c.Role, &flags.Role},
+		{&c.Output, &flags.Output},
+		{&c.Destination, &flags.Destination},
+		{&c.DeadLetter, &flags.DeadLetter},
+		{&c.Versions, &flags.Versions},
+	} {
+		if *field.flag != "" {
+			*field.value = *field.flag
+		}
+	}
+	if len(flags.Overlays) > 0 {
+		c.Overlays = flags.Overlays
+	}
+	return c
+}
+
+// defaults sets the fields of the config that are not set, and validates the roles
+func (c Config) defaults() Config {
+	if c.Input == "" {
+		c.Input = "asyncapi.yml"
+	}
+	if c.Type == "" {
+		c.Type = "flogoapiapp"
+	}
+	if c.Role == "" {
+		c.Role = "server"
+	}
+	if c.Output == "" {
+		c.Output = "."
+	}
+	switch c.Role {
+	case "server":
+	case "client":
+	case "both":
+	default:
+		panic("invalid role")
+	}
+	for name, server := range c.Servers {
+		switch server.Role {
+		case "", "server", "client", "both":
+		default:
+			panic(fmt.Errorf("server %s: invalid role %s", name, server.Role))
+		}
+	}
+	return c
+}
+
+// options returns the options of a conversion with the config
+func (c Config) options() options {
+	o := options{
+		role:        c.Role,
+		destination: parseDestinationRules(c.Destination),
+		deadLetter:  parseDeadLetterRules(c.DeadLetter),
+		versions:    versionLock{},
+		config:      c,
+	}
+	for module, version := range c.Pins {
+		o.versions[module] = version
+	}
+	for module, version := range readVersionLock(c.Versions) {
+		o.versions[module] = version
+	}
+	if c.Features.DeadLetters != nil {
+		if *c.Features.DeadLetters {
+			o.deadLetter.enabled = true
+		} else {
+			o.deadLetter.disabled = true
+		}
+	}
+	return o
+}
+
+// layout returns the name of a generated file, or its default name
+func layout(name, file string) string {
+	if name == "" {
+		return file
+	}
+	return name
+}
+
+// serverRole returns the role of a server, the x-flogo-role extension of the server overrides the role of the conversion
+func (o options) serverRole(name string, server *models.Server) string {
+	value, ok := server.AdditionalProperties["x-flogo-role"]
+	if !ok {
+		return o.role
+	}
+	switch value {
+	case "server", "client", "both":
+		return value.(string)
+	}
+	panic(fmt.Errorf("%s: server %s: invalid role %v", o.specs[name], name, value))
+}
+
+// loopback returns true if a server of the protocol has the both role, the app then serves and consumes its channels
+func (o options) loopback(model *models.AsyncAPI200Schema, p protocolConfig) bool {
+	for name, server := range model.Servers {
+		if protocol := server.Protocol; (protocol == p.name || protocol == p.secure) && o.serverRole(name, server) == "both" {
+			return true
+		}
+	}
+	return false
+}
+
+// credentials returns the environment variables of the credentials of a server
+func (o options) credentials(protocol, name string) CredentialsConfig {
+	return defaultCredentials.merge(o.config.Protocols[protocol].Credentials).merge(o.config.Servers[name].Credentials)
+}
+
+// specValue converts a value of the config to a value of the spec, numbers of the spec are float64
+func specValue(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	var converted interface{}
+	err = json.Unmarshal(data, &converted)
+	if err != nil {
+		panic(err)
+	}
+	return converted
+}
+
+// matchChannel returns true if the channel matches one of the patterns
+func matchChannel(patterns []string, channel string) bool {
+	channel = strings.Trim(channel, "/")
+	for _, pattern := range patterns {
+		if matched, err := path.Match(strings.Trim(pattern, "/"), channel); err != nil {
+			panic(fmt.Errorf("invalid channel filter %s", pattern))
+		} else if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// apply filters the spec and overrides its servers and extensions with the config
+func (c Config) apply(model *models.AsyncAPI200Schema) {
+	if len(c.Filters.Servers) > 0 {
+		selected := make(map[string]*models.Server, len(c.Filters.Servers))
+		for _, name := range c.Filters.Servers {
+			server, ok := model.Servers[name]
+			if !ok {
+				panic(fmt.Errorf("filtered server %s is not defined", name))
+			}
+			selected[name] = server
+		}
+		model.Servers = selected
+	}
+	if len(c.Filters.Channels) > 0 && model.Channels != nil {
+		for name := range model.Channels.AdditionalProperties {
+			if !matchChannel(c.Filters.Channels, name) {
+				delete(model.Channels.AdditionalProperties, name)
+			}
+		}
+	}
+
+	setExtension := func(extensions *map[string]interface{}, name string, value interface{}) {
+		if *extensions == nil {
+			*extensions = make(map[string]interface{})
+		}
+		(*extensions)[name] = value
+	}
+	for _, server := range model.Servers {
+		for name, protocol := range c.Protocols {
+			if config, ok := lookupProtocol(name); !ok {
+				panic(fmt.Errorf("invalid protocol %s", name))
+			} else if current := server.Protocol; current != config.name && current != config.secure {
+				continue
+			}
+			if protocol.TriggerVersion != "" {
+				setExtension(&server.AdditionalProperties, "x-trigger-version", protocol.TriggerVersion)
+			}
+			if protocol.ActivityVersion != "" {
+				setExtension(&server.AdditionalProperties, "x-activity-version", protocol.ActivityVersion)
+			}
+		}
+	}
+	for name, config := range c.Servers {
+		server, ok := model.Servers[name]
+		if !ok {
+			if len(c.Filters.Servers) > 0 {
+				continue
+			}
+			panic(fmt.Errorf("configured server %s is not defined", name))
+		}
+		if config.Role != "" {
+			setExtension(&server.AdditionalProperties, "x-flogo-role", config.Role)
+		}
+		if config.Protocol != "" {
+			server.Protocol = config.Protocol
+		}
+		if config.URL != "" {
+			server.Url = config.URL
+		}
+		if config.TriggerVersion != "" {
+			setExtension(&server.AdditionalProperties, "x-trigger-version", config.TriggerVersion)
+		}
+		if config.ActivityVersion != "" {
+			setExtension(&server.AdditionalProperties, "x-activity-version", config.ActivityVersion)
+		}
+		for extension, value := range config.Extensions {
+			setExtension(&server.AdditionalProperties, extension, specValue(value))
+		}
+	}
+
+	if c.Features.Service != nil {
+		setExtension(&model.AdditionalProperties, "x-service", *c.Features.Service)
+	}
+	if c.Features.Bridge != "" {
+		bridge, ok := model.AdditionalProperties["x-publish-bridge"].(map[string]interface{})
+		if !ok {
+			bridge = make(map[string]interface{})
+		}
+		bridge["ingress"] = c.Features.Bridge
+		setExtension(&model.AdditionalProperties, "x-publish-bridge", bridge)
+	}
+}
+
+// lookupProtocol returns the config of a protocol by name
+func lookupProtocol(name string) (protocolConfig, bool) {
+	for _, config := range configs {
+		if config.name == name || config.secure == name {
+			return config, true
+		}
+	}
+	return protocolConfig{}, false
+}
+
+// parse parses and merges the specs of the input, and applies the overlays and the config of the options
+func parse(input string, o *options) models.AsyncAPI200Schema {
+	model, specs := mergeSpecs(inputFiles(input))
+	applyOverlays(&model, o.config.Overlays)
+	o.config.apply(&model)
+	// the servers of the overlays are reported with the input
+	for name := range model.Servers {
+		if _, ok := specs[name]; !ok {
+			specs[name] = input
+		}
+	}
+	o.specs = specs
+	return model
+}
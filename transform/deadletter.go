@@ -0,0 +1,298 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/project-flogo/microgateway/api"
+)
+
+const (
+	// defaultRetries is the number of retries of a failed message
+	defaultRetries = "3"
+	// defaultBackoff is the delay before the first retry, it doubles with each retry
+	defaultBackoff = "1s"
+)
+
+// deadLetterRules configure the retries of the messages of a channel and their dead-letter destination
+type deadLetterRules struct {
+	enabled     bool
+	disabled    bool
+	destination string
+	retries     string
+	backoff     string
+}
+
+// merge overrides the rules with the rules that are set
+func (d deadLetterRules) merge(rules deadLetterRules) deadLetterRules {
+	if rules.enabled {
+		d.enabled = true
+	}
+	if rules.disabled {
+		d.disabled = true
+	}
+	if rules.destination != "" {
+		d.destination = rules.destination
+	}
+	if rules.retries != "" {
+		d.retries = rules.retries
+	}
+	if rules.backoff != "" {
+		d.backoff = rules.backoff
+	}
+	return d
+}
+
+// set sets a rule by name
+func (d *deadLetterRules) set(name, value string) {
+	switch name {
+	case "destination":
+		d.destination = value
+	case "retries":
+		if retries, err := strconv.Atoi(value); err != nil || retries < 0 {
+			panic(fmt.Errorf("invalid dead-letter retries %s", value))
+		}
+		d.retries = value
+	case "backoff":
+		if _, err := time.ParseDuration(value); err != nil {
+			panic(fmt.Errorf("invalid dead-letter backoff %s", value))
+		}
+		d.backoff = value
+	default:
+		panic(fmt.Errorf("invalid dead-letter rule %s", name))
+	}
+	d.enabled = true
+}
+
+// parseDeadLetterRules parses rules like destination={destination}.dlq,retries=3,backoff=1s
+func parseDeadLetterRules(rules string) deadLetterRules {
+	parsed := deadLetterRules{}
+	if rules == "" {
+		return parsed
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			panic(fmt.Errorf("invalid dead-letter rule %s", rule))
+		}
+		parsed.set(strings.TrimSpace(parts[0]), parts[1])
+	}
+	return parsed
+}
+
+// deadLetterExtension reads the x-dead-letter extension of a channel, either a destination, rules or a boolean
+func deadLetterExtension(extensions map[string]interface{}) deadLetterRules {
+	rules := deadLetterRules{}
+	switch value := extensions["x-dead-letter"].(type) {
+	case string:
+		rules.set("destination", value)
+	case bool:
+		rules.enabled, rules.disabled = value, !value
+	case map[string]interface{}:
+		rules.enabled = true
+		for name, value := range value {
+			rules.set(name, fmt.Sprint(value))
+		}
+	}
+	return rules
+}
+
+// deadLetter is the resolved dead-letter configuration of a channel
+type deadLetter struct {
+	destination string
+	retries     int
+	backoff     string
+}
+
+// deadLetter resolves the rules of the channel, the destination is built from {destination} and {channel}
+func (s settings) deadLetter(rules deadLetterRules) (deadLetter, bool) {
+	if !rules.enabled || rules.disabled {
+		return deadLetter{}, false
+	}
+	if rules.destination == "" {
+		separator := s.protocolConfig.destination.separator
+		if separator == "" {
+			separator = "/"
+		}
+		rules.destination = "{destination}" + separator + "dlq"
+	}
+	if rules.retries == "" {
+		rules.retries = defaultRetries
+	}
+	if rules.backoff == "" {
+		rules.backoff = defaultBackoff
+	}
+	retries, _ := strconv.Atoi(rules.retries)
+	return deadLetter{
+		destination: strings.NewReplacer(
+			"{destination}", s.destination,
+			"{channel}", strings.TrimPrefix(s.topic, "/"),
+		).Replace(rules.destination),
+		retries: retries,
+		backoff: rules.backoff,
+	}, true
+}
+
+// deadLetterService returns the publish service sending the failed messages of the channel to its dead-letter destination
+func (s settings) deadLetterService(d deadLetter) *api.Service {
+	if s.activity == "" {
+		return nil
+	}
+	name := fmt.Sprintf("%s-deadletter-%s", s.name, s.topic)
+	s.destination = d.destination
+	s.topic = "/" + strings.TrimPrefix(d.destination, "/")
+	s.protocolInfo = nil
+	s.message = nil
+	settings := s.serviceSettings(s)
+	if settings == nil {
+		return nil
+	}
+	return &api.Service{
+		Name:        name,
+		Ref:         s.activity,
+		Description: fmt.Sprintf("%s dead-letter service", s.name),
+		Settings:    settings,
+	}
+}
+
+// addDeadLetterSteps adds a step per channel publishing the messages the invoker gave up on
+func (p protocolConfig) addDeadLetterSteps(gateway *api.Microgateway, services map[string]*api.Service) {
+	channels := make([]string, 0, len(services))
+	for channel := range services {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	for _, channel := range channels {
+		service := services[channel]
+		gateway.Services = append(gateway.Services, service)
+		step := &api.Step{
+			Condition: fmt.Sprintf("$.methodinvoker.outputs.outputData.deadLetter == true && $.payload.channel == '%s'", channel),
+			Service:   service.Name,
+			Input: map[string]interface{}{
+				p.serviceInput: "=$.methodinvoker.outputs.outputData.deadLetterMessage",
+			},
+		}
+		if p.serviceHeaders != "" {
+			step.Input[p.serviceInput] = "=$.payload.message"
+			step.Input[p.serviceHeaders] = "=$.methodinvoker.outputs.outputData.deadLetterHeaders"
+		}
+		gateway.Steps = append(gateway.Steps, step)
+	}
+}
+
+// invokedMethods returns the sorted methods the invoker can call, the methods of the dispatched messages included
+func invokedMethods(name string, dispatch map[string][]messageCandidate) []string {
+	unique := map[string]bool{name + "Method": true}
+	if len(dispatch) > 0 {
+		unique[name+"DeadLetter"] = true
+	}
+	for _, candidates := range dispatch {
+		for _, candidate := range candidates {
+			unique[candidate.method] = true
+		}
+	}
+	methods := make([]string, 0, len(unique))
+	for method := range unique {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// writeInvoker writes the method invoking the method of a message with retries,
+// the message is handed to the dead-letter steps if all attempts fail
+func writeInvoker(support *supportCode, name string, methods []string, deadLetters map[string]deadLetter) {
+	support.addImport("encoding/json")
+	support.addImport("fmt")
+	support.addImport("strconv")
+	support.addImport("time")
+	support.writeOnce("invoke", invokeSupport)
+
+	channels := make([]string, 0, len(deadLetters))
+	for channel := range deadLetters {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	fmt.Fprintf(support, "var %sRetries = map[string]retryPolicy{\n", name)
+	for _, channel := range channels {
+		fmt.Fprintf(support, "\t%q: {retries: %d, backoff: %q},\n", channel, deadLetters[channel].retries, deadLetters[channel].backoff)
+	}
+	fmt.Fprintf(support, "}\n")
+	fmt.Fprintf(support, "var %sMethods = map[string]func(inputs interface{}) (map[string]interface{}, error){\n", name)
+	for _, method := range methods {
+		fmt.Fprintf(support, "\t%q: %s,\n", method, method)
+	}
+	fmt.Fprintf(support, "}\n")
+	fmt.Fprintf(support, methodInvoker, name)
+	fmt.Fprintf(support, "func init() {\n")
+	fmt.Fprintf(support, "\tmethodinvoker.RegisterMethods(\"%sInvoke\", %sInvoke)\n", name, name)
+	fmt.Fprintf(support, "}\n")
+}
+
+const methodInvoker = `func %[1]sInvoke(inputs interface{}) (map[string]interface{}, error) {
+	values, _ := inputs.(map[string]interface{})
+	channel, _ := values["channel"].(string)
+	name, _ := values["method"].(string)
+	if name == "" {
+		name = "%[1]sMethod"
+	}
+	method, ok := %[1]sMethods[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown method %%s", name)
+	}
+	policy, deadLetter := %[1]sRetries[channel]
+	if !deadLetter {
+		// the errors of the channels without a dead-letter policy are returned to the trigger
+		return method(values)
+	}
+	return invokeMethod(method, policy, name == "%[1]sDeadLetter", channel, values)
+}
+`
+
+const invokeSupport = `type retryPolicy struct {
+	retries int
+	backoff string
+}
+func invokeMethod(method func(inputs interface{}) (map[string]interface{}, error), policy retryPolicy,
+	unmatched bool, channel string, values map[string]interface{}) (map[string]interface{}, error) {
+	backoff, _ := time.ParseDuration(policy.backoff)
+	attempts := 0
+	var err error
+	for {
+		attempts++
+		var outputs map[string]interface{}
+		outputs, err = method(values)
+		if unmatched {
+			err = fmt.Errorf("message matches none of the messages of channel %s", channel)
+			break
+		}
+		if err == nil {
+			return outputs, nil
+		}
+		if attempts > policy.retries {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	envelope, _ := json.Marshal(map[string]interface{}{
+		"channel":  channel,
+		"error":    err.Error(),
+		"attempts": attempts,
+		"message":  values["message"],
+	})
+	return map[string]interface{}{
+		"deadLetter":        true,
+		"error":             err.Error(),
+		"deadLetterMessage": string(envelope),
+		"deadLetterHeaders": map[string]string{
+			"x-dead-letter-channel":  channel,
+			"x-dead-letter-error":    err.Error(),
+			"x-dead-letter-attempts": strconv.Itoa(attempts),
+		},
+	}, nil
+}
+`
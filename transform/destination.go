@@ -0,0 +1,117 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// destinationRules map a channel name to the destination of a protocol
+type destinationRules struct {
+	separator string
+	prefix    string
+	letters   string
+	template  string
+}
+
+// merge overrides the rules with the rules that are set
+func (d destinationRules) merge(rules destinationRules) destinationRules {
+	if rules.separator != "" {
+		d.separator = rules.separator
+	}
+	if rules.prefix != "" {
+		d.prefix = rules.prefix
+	}
+	if rules.letters != "" {
+		d.letters = rules.letters
+	}
+	if rules.template != "" {
+		d.template = rules.template
+	}
+	return d
+}
+
+// set sets a rule by name
+func (d *destinationRules) set(name, value string) {
+	switch name {
+	case "separator":
+		d.separator = value
+	case "prefix":
+		d.prefix = value
+	case "case":
+		switch value {
+		case "lower", "upper", "preserve":
+		default:
+			panic(fmt.Errorf("invalid destination case %s", value))
+		}
+		d.letters = value
+	case "template":
+		d.template = value
+	default:
+		panic(fmt.Errorf("invalid destination rule %s", name))
+	}
+}
+
+// parseDestinationRules parses rules like separator=.,prefix=acme.,case=lower,template={channel}
+func parseDestinationRules(rules string) destinationRules {
+	parsed := destinationRules{}
+	if rules == "" {
+		return parsed
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			panic(fmt.Errorf("invalid destination rule %s", rule))
+		}
+		parsed.set(strings.TrimSpace(parts[0]), parts[1])
+	}
+	return parsed
+}
+
+// destinationExtension reads the x-destination extension of a channel
+func destinationExtension(extensions map[string]interface{}) (string, destinationRules) {
+	rules := destinationRules{}
+	switch value := extensions["x-destination"].(type) {
+	case string:
+		return value, rules
+	case map[string]interface{}:
+		for name, value := range value {
+			if value, ok := value.(string); ok {
+				rules.set(name, value)
+			}
+		}
+	}
+	return "", rules
+}
+
+// destination maps the channel name to a destination, channel parameters are kept
+func (d destinationRules) destination(channel, protocol, server string) string {
+	separator := d.separator
+	if separator == "" {
+		separator = "/"
+	}
+	chunks, _ := parseURL(strings.TrimPrefix(channel, "/"))
+	name := ""
+	for _, chunk := range chunks {
+		if chunk.value == "" {
+			name += "{" + chunk.name + "}"
+			continue
+		}
+		value := strings.Replace(chunk.value, "/", separator, -1)
+		switch d.letters {
+		case "lower":
+			value = strings.ToLower(value)
+		case "upper":
+			value = strings.ToUpper(value)
+		}
+		name += value
+	}
+	name = d.prefix + name
+	if d.template != "" {
+		name = strings.NewReplacer(
+			"{channel}", name,
+			"{protocol}", protocol,
+			"{server}", server,
+		).Replace(d.template)
+	}
+	return name
+}
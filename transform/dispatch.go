@@ -0,0 +1,324 @@
+package transform
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/project-flogo/asyncapi/transform/models"
+)
+
+// messageCandidate is a message of an operation with multiple messages
+type messageCandidate struct {
+	name          string
+	method        string
+	typ           string
+	headersType   string
+	discriminator string
+	value         string
+	headers       map[string]string
+	required      []string
+	consts        map[string]string
+}
+
+// operationMessages returns the messages of an operation, either a single message or the messages of oneOf
+func operationMessages(operation *models.Operation) []map[string]interface{} {
+	message, ok := operation.Message.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	oneOf, ok := message["oneOf"].([]interface{})
+	if !ok {
+		return []map[string]interface{}{message}
+	}
+	messages := make([]map[string]interface{}, 0, len(oneOf))
+	for _, value := range oneOf {
+		if value, ok := value.(map[string]interface{}); ok {
+			messages = append(messages, value)
+		}
+	}
+	return messages
+}
+
+// messageSchema returns a schema of the message or of its traits
+func (s settings) messageSchema(name string) map[string]interface{} {
+	if schema, ok := s.message[name].(map[string]interface{}); ok {
+		return schema
+	}
+	if traits, ok := s.message["traits"].([]interface{}); ok {
+		for i := len(traits) - 1; i >= 0; i-- {
+			if trait, ok := traits[i].(map[string]interface{}); ok {
+				if schema, ok := trait[name].(map[string]interface{}); ok {
+					return schema
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// schemaConst returns the constant value of a json schema, an enum with a single value is a constant
+func schemaConst(schema interface{}) (string, bool) {
+	value, ok := schema.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	if constant, ok := value["const"]; ok {
+		return fmt.Sprint(constant), true
+	}
+	if enum, ok := value["enum"].([]interface{}); ok && len(enum) == 1 {
+		return fmt.Sprint(enum[0]), true
+	}
+	return "", false
+}
+
+// payloadType writes the go type of the message payload and returns it, empty if the payload has no typed decoder
+func (s settings) payloadType(support *supportCode, name string) string {
+	switch s.messageCodec() {
+	case "avro":
+		if schema, ok := avroSchema(s).(map[string]interface{}); ok && (schema["type"] == "record" || schema["type"] == "error") {
+			return avroGoType(support, schema)
+		}
+	case "protobuf":
+		return protoType(support, s)
+	case "json", "xml":
+		if schema, ok := s.message["payload"].(map[string]interface{}); ok {
+			if properties, ok := schema["properties"].(map[string]interface{}); ok && len(properties) > 0 && schemaType(schema) == "object" {
+				return schemaGoType(support, name, schema)
+			}
+		}
+	}
+	return ""
+}
+
+// messageCandidates returns the candidates the message of a channel is matched against, by discriminator, header or schema
+func (s settings) messageCandidates(support *supportCode, messages []map[string]interface{}) []messageCandidate {
+	candidates := make([]messageCandidate, 0, len(messages))
+	for i, message := range messages {
+		s.message = message
+		name := s.messageField("name")
+		if name == "" {
+			name = s.messageField("title")
+		}
+		if name == "" {
+			name = fmt.Sprintf("message%d", i+1)
+		}
+		candidate := messageCandidate{
+			name:        name,
+			method:      fmt.Sprintf("%s%sMethod", s.name, goName(name)),
+			typ:         s.payloadType(support, goName(name)),
+			headersType: s.headersType(support, goName(name)),
+		}
+		if headers := s.messageSchema("headers"); headers != nil {
+			properties, _ := headers["properties"].(map[string]interface{})
+			for header, schema := range properties {
+				if value, ok := schemaConst(schema); ok {
+					if candidate.headers == nil {
+						candidate.headers = make(map[string]string)
+					}
+					candidate.headers[header] = value
+				}
+			}
+			if len(candidate.headers) > 0 && s.headersPath == "" {
+				fmt.Fprintf(os.Stderr, "warning: channel %s: message %s is selected by headers the %s protocol doesn't receive\n", s.topic, name, s.name)
+			}
+		}
+		payload, _ := s.message["payload"].(map[string]interface{})
+		properties, _ := payload["properties"].(map[string]interface{})
+		if discriminator, ok := payload["discriminator"].(string); ok && discriminator != "" {
+			candidate.discriminator, candidate.value = discriminator, name
+			if value, ok := schemaConst(properties[discriminator]); ok {
+				candidate.value = value
+			}
+		}
+		if required, ok := payload["required"].([]interface{}); ok {
+			for _, value := range required {
+				if value, ok := value.(string); ok {
+					candidate.required = append(candidate.required, value)
+				}
+			}
+		}
+		for property, schema := range properties {
+			if property == candidate.discriminator {
+				continue
+			}
+			if value, ok := schemaConst(schema); ok {
+				if candidate.consts == nil {
+					candidate.consts = make(map[string]string)
+				}
+				candidate.consts[property] = value
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// writeDispatcher writes the method selecting the handler method of the message of each channel,
+// the methods invoke the service methods of the messages if the service is generated
+func writeDispatcher(support *supportCode, name string, dispatch map[string][]messageCandidate, service bool) {
+	support.addImport("fmt")
+	support.writeOnce("dispatch", dispatchSupport)
+
+	literal := func(values map[string]string) string {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		code := "map[string]string{"
+		for i, key := range keys {
+			if i > 0 {
+				code += ", "
+			}
+			code += fmt.Sprintf("%q: %q", key, values[key])
+		}
+		return code + "}"
+	}
+	channels := make([]string, 0, len(dispatch))
+	for channel := range dispatch {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	fmt.Fprintf(support, "var %sMessages = map[string][]messageCandidate{\n", name)
+	for _, channel := range channels {
+		fmt.Fprintf(support, "\t%q: {\n", channel)
+		for _, candidate := range dispatch[channel] {
+			fields := fmt.Sprintf("name: %q, method: %q", candidate.name, candidate.method)
+			if candidate.discriminator != "" {
+				fields += fmt.Sprintf(", discriminator: %q, value: %q", candidate.discriminator, candidate.value)
+			}
+			if len(candidate.headers) > 0 {
+				fields += ", headers: " + literal(candidate.headers)
+			}
+			if len(candidate.required) > 0 {
+				fields += fmt.Sprintf(", required: %#v", candidate.required)
+			}
+			if len(candidate.consts) > 0 {
+				fields += ", consts: " + literal(candidate.consts)
+			}
+			fmt.Fprintf(support, "\t\t{%s},\n", fields)
+		}
+		fmt.Fprintf(support, "\t},\n")
+	}
+	fmt.Fprintf(support, "}\n")
+	fmt.Fprintf(support, messageDispatcher, name)
+
+	methods := []string{}
+	for _, channel := range channels {
+		for _, candidate := range dispatch[channel] {
+			if !support.once("method:" + candidate.method) {
+				continue
+			}
+			methods = append(methods, candidate.method)
+			if service {
+				fmt.Fprintf(support, "func %s(inputs interface{}) (map[string]interface{}, error) {\n", candidate.method)
+				fmt.Fprintf(support, "\treturn invokeOperation(%sOperations, %q, inputs)\n", name, candidate.name)
+				fmt.Fprintf(support, "}\n")
+				continue
+			}
+			body := ""
+			if candidate.typ != "" || candidate.headersType != "" {
+				body += "\tvalues, _ := inputs.(map[string]interface{})\n"
+			}
+			if candidate.typ != "" {
+				body += fmt.Sprintf("\tpayload, err := Decode%s(values[\"message\"])\n", candidate.typ)
+				body += "\tif err != nil {\n\t\treturn nil, err\n\t}\n"
+				body += "\t_ = payload\n"
+			}
+			if candidate.headersType != "" {
+				body += fmt.Sprintf("\theaders, err := Decode%s(values[\"headers\"])\n", candidate.headersType)
+				body += "\tif err != nil {\n\t\treturn nil, err\n\t}\n"
+				body += "\t_ = headers\n"
+			}
+			support.handler(name, candidate.method, fmt.Sprintf(handlerStub, candidate.method, "the "+candidate.name+" messages", body))
+		}
+	}
+	support.handler(name, name+"DeadLetter", fmt.Sprintf(handlerStub, name+"DeadLetter", "the messages which match none of the messages of their channel", ""))
+	fmt.Fprintf(support, "func init() {\n")
+	fmt.Fprintf(support, "\tmethodinvoker.RegisterMethods(\"%sDispatch\", %sDispatch)\n", name, name)
+	for _, method := range methods {
+		fmt.Fprintf(support, "\tmethodinvoker.RegisterMethods(%q, %s)\n", method, method)
+	}
+	fmt.Fprintf(support, "\tmethodinvoker.RegisterMethods(\"%sDeadLetter\", %sDeadLetter)\n", name, name)
+	fmt.Fprintf(support, "}\n")
+}
+
+const messageDispatcher = `func %[1]sDispatch(inputs interface{}) (map[string]interface{}, error) {
+	values, _ := inputs.(map[string]interface{})
+	channel, _ := values["channel"].(string)
+	outputs := make(map[string]interface{}, len(values)+3)
+	for key, value := range values {
+		outputs[key] = value
+	}
+	outputs["valid"] = true
+	candidates, ok := %[1]sMessages[channel]
+	if !ok {
+		outputs["method"] = "%[1]sMethod"
+		return outputs, nil
+	}
+	if candidate, ok := matchMessage(candidates, values["message"], values["headers"]); ok {
+		outputs["method"], outputs["messageName"] = candidate.method, candidate.name
+		return outputs, nil
+	}
+	outputs["method"] = "%[1]sDeadLetter"
+	return outputs, nil
+}
+`
+
+const dispatchSupport = `type messageCandidate struct {
+	name          string
+	method        string
+	discriminator string
+	value         string
+	headers       map[string]string
+	required      []string
+	consts        map[string]string
+}
+func matchMessage(candidates []messageCandidate, message, headers interface{}) (messageCandidate, bool) {
+	fields, _ := message.(map[string]interface{})
+	header := func(name string) (string, bool) {
+		switch headers := headers.(type) {
+		case map[string]string:
+			value, ok := headers[name]
+			return value, ok
+		case map[string]interface{}:
+			value, ok := headers[name]
+			if data, isData := value.([]byte); isData {
+				return string(data), ok
+			}
+			return fmt.Sprint(value), ok
+		}
+		return "", false
+	}
+	field := func(name, expected string) bool {
+		value, ok := fields[name]
+		return ok && fmt.Sprint(value) == expected
+	}
+	for _, candidate := range candidates {
+		matched := true
+		if candidate.discriminator != "" {
+			matched = field(candidate.discriminator, candidate.value)
+		}
+		for name, expected := range candidate.headers {
+			if value, ok := header(name); !ok || value != expected {
+				matched = false
+			}
+		}
+		for _, name := range candidate.required {
+			if _, ok := fields[name]; !ok {
+				matched = false
+			}
+		}
+		for name, expected := range candidate.consts {
+			if !field(name, expected) {
+				matched = false
+			}
+		}
+		if matched {
+			return candidate, true
+		}
+	}
+	return messageCandidate{}, false
+}
+`
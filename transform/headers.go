@@ -0,0 +1,264 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+)
+
+// messageHeader is a header of the headers schema of a message
+type messageHeader struct {
+	name     string
+	typ      string
+	enum     []string
+	required bool
+	def      string
+	minimum  string
+	maximum  string
+}
+
+// messageHeaders returns the headers of the headers schema of the message sorted by name
+func (s settings) messageHeaders() []messageHeader {
+	schema := s.messageSchema("headers")
+	properties, _ := schema["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	if values, ok := schema["required"].([]interface{}); ok {
+		for _, value := range values {
+			if value, ok := value.(string); ok {
+				required[value] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	headers := make([]messageHeader, 0, len(names))
+	for _, name := range names {
+		header := messageHeader{
+			name:     name,
+			typ:      "string",
+			required: required[name],
+		}
+		property, _ := properties[name].(map[string]interface{})
+		if typ := schemaType(property); typ != "" {
+			header.typ = typ
+		}
+		if value, ok := property["const"]; ok {
+			header.enum = []string{fmt.Sprint(value)}
+		}
+		if enum, ok := property["enum"].([]interface{}); ok {
+			for _, value := range enum {
+				header.enum = append(header.enum, fmt.Sprint(value))
+			}
+		}
+		if value, ok := property["default"]; ok {
+			header.def = fmt.Sprint(value)
+		}
+		if value, ok := property["minimum"]; ok {
+			header.minimum = fmt.Sprint(value)
+		}
+		if value, ok := property["maximum"]; ok {
+			header.maximum = fmt.Sprint(value)
+		}
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+// headersType writes the go type of the headers schema of the message and returns it, empty if there is none
+func (s settings) headersType(support *supportCode, name string) string {
+	schema := s.messageSchema("headers")
+	if properties, ok := schema["properties"].(map[string]interface{}); !ok || len(properties) == 0 {
+		return ""
+	}
+	return schemaGoType(support, name+"Headers", schema)
+}
+
+// channelHeaders returns the headers of the messages of a channel, the headers of a message selected by the
+// dispatcher are keyed by the channel and the message name
+func (s settings) channelHeaders(support *supportCode, messages []map[string]interface{}, candidates []messageCandidate) map[string][]messageHeader {
+	headers := make(map[string][]messageHeader)
+	for i, message := range messages {
+		s.message = message
+		key := s.topic
+		if len(candidates) > 1 {
+			key += "#" + candidates[i].name
+		} else if name := s.messageField("name"); name != "" {
+			s.headersType(support, goName(name))
+		}
+		if values := s.messageHeaders(); len(values) > 0 {
+			headers[key] = values
+		}
+	}
+	return headers
+}
+
+// writeHeadersValidator writes a method converting and validating the headers of each channel,
+// the publish method keeps the headers of the schema, with their default or constant if they are missing
+func writeHeadersValidator(support *supportCode, name, method string, headers map[string][]messageHeader) {
+	support.addImport("fmt")
+	support.addImport("strconv")
+	support.addImport("strings")
+	support.writeOnce("headers", headersSupport)
+
+	channels := make([]string, 0, len(headers))
+	for channel := range headers {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	fmt.Fprintf(support, "var %s%sSchema = map[string][]messageHeader{\n", name, method)
+	for _, channel := range channels {
+		fmt.Fprintf(support, "\t%q: {\n", channel)
+		for _, header := range headers[channel] {
+			fields := fmt.Sprintf("name: %q, typ: %q", header.name, header.typ)
+			if len(header.enum) > 0 {
+				fields += fmt.Sprintf(", enum: %#v", header.enum)
+			}
+			if header.required {
+				fields += ", required: true"
+			}
+			if header.def != "" {
+				fields += fmt.Sprintf(", def: %q", header.def)
+			}
+			if header.minimum != "" {
+				fields += fmt.Sprintf(", minimum: %q", header.minimum)
+			}
+			if header.maximum != "" {
+				fields += fmt.Sprintf(", maximum: %q", header.maximum)
+			}
+			fmt.Fprintf(support, "\t\t{%s},\n", fields)
+		}
+		fmt.Fprintf(support, "\t},\n")
+	}
+	fmt.Fprintf(support, "}\n")
+	publish := method == "PublishHeaders"
+	fmt.Fprintf(support, headersValidator, name, method, publish)
+	fmt.Fprintf(support, "func init() {\n")
+	fmt.Fprintf(support, "\tmethodinvoker.RegisterMethods(\"%s%s\", %s%s)\n", name, method, name, method)
+	fmt.Fprintf(support, "}\n")
+}
+
+const headersValidator = `func %[1]s%[2]s(inputs interface{}) (map[string]interface{}, error) {
+	values, _ := inputs.(map[string]interface{})
+	channel, _ := values["channel"].(string)
+	if name, ok := values["messageName"].(string); ok {
+		channel += "#" + name
+	}
+	outputs := make(map[string]interface{}, len(values)+2)
+	for key, value := range values {
+		outputs[key] = value
+	}
+	headers, err := validateHeaders(%[1]s%[2]sSchema[channel], values["headers"], %[3]t)
+	if err != nil {
+		outputs["valid"], outputs["error"] = false, err.Error()
+		return outputs, nil
+	}
+	outputs["headers"], outputs["valid"] = headers, true
+	return outputs, nil
+}
+`
+
+const headersSupport = `type messageHeader struct {
+	name     string
+	typ      string
+	enum     []string
+	required bool
+	def      string
+	minimum  string
+	maximum  string
+}
+func validateHeaders(schema []messageHeader, headers interface{}, publish bool) (interface{}, error) {
+	raw := make(map[string]string)
+	switch headers := headers.(type) {
+	case map[string]string:
+		raw = headers
+	case map[string]interface{}:
+		for key, value := range headers {
+			if data, ok := value.([]byte); ok {
+				value = string(data)
+			}
+			raw[key] = fmt.Sprint(value)
+		}
+	}
+	lookup := func(name string) (string, bool) {
+		if value, ok := raw[name]; ok {
+			return value, true
+		}
+		for key, value := range raw {
+			if strings.EqualFold(key, name) {
+				return value, true
+			}
+		}
+		return "", false
+	}
+	if publish {
+		outgoing := make(map[string]string, len(schema))
+		for _, header := range schema {
+			if value, ok := lookup(header.name); ok {
+				outgoing[header.name] = value
+			} else if header.def != "" {
+				outgoing[header.name] = header.def
+			} else if len(header.enum) == 1 {
+				outgoing[header.name] = header.enum[0]
+			}
+		}
+		return outgoing, nil
+	}
+	typed := make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		typed[key] = value
+	}
+	for _, header := range schema {
+		value, ok := lookup(header.name)
+		if !ok {
+			if header.def != "" {
+				value = header.def
+			} else if header.required {
+				return nil, fmt.Errorf("missing header %s", header.name)
+			} else {
+				continue
+			}
+		}
+		var converted interface{} = value
+		var number float64
+		var err error
+		switch header.typ {
+		case "integer":
+			var integer int64
+			integer, err = strconv.ParseInt(value, 10, 64)
+			converted, number = integer, float64(integer)
+		case "number":
+			number, err = strconv.ParseFloat(value, 64)
+			converted = number
+		case "boolean":
+			converted, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("header %s is not a %s", header.name, header.typ)
+		}
+		if len(header.enum) > 0 {
+			found := false
+			for _, allowed := range header.enum {
+				if allowed == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("header %s has an invalid value %s", header.name, value)
+			}
+		}
+		if header.typ == "integer" || header.typ == "number" {
+			if minimum, err := strconv.ParseFloat(header.minimum, 64); err == nil && number < minimum {
+				return nil, fmt.Errorf("header %s is less than %s", header.name, header.minimum)
+			}
+			if maximum, err := strconv.ParseFloat(header.maximum, 64); err == nil && number > maximum {
+				return nil, fmt.Errorf("header %s is greater than %s", header.name, header.maximum)
+			}
+		}
+		typed[header.name] = converted
+	}
+	return typed, nil
+}
+`
@@ -0,0 +1,196 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/project-flogo/asyncapi/transform/models"
+)
+
+// inputFiles returns the spec files of a comma separated input
+func inputFiles(input string) []string {
+	files := []string{}
+	for _, file := range strings.Split(input, ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		panic(fmt.Errorf("no input spec"))
+	}
+	return files
+}
+
+// specDocument parses a spec and returns it as a json document
+func specDocument(file string) map[string]interface{} {
+	model, err := models.Parse(file)
+	if err != nil {
+		panic(fmt.Errorf("%s: %v", file, err))
+	}
+	data, err := json.Marshal(&model)
+	if err != nil {
+		panic(err)
+	}
+	document := make(map[string]interface{})
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		panic(err)
+	}
+	return document
+}
+
+// resolveFiles makes the x-proto-file paths of a document relative to its directory absolute
+func resolveFiles(node interface{}, directory string) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			if path, ok := value.(string); ok && key == "x-proto-file" && !filepath.IsAbs(path) {
+				node[key] = filepath.Join(directory, path)
+				continue
+			}
+			resolveFiles(value, directory)
+		}
+	case []interface{}:
+		for _, value := range node {
+			resolveFiles(value, directory)
+		}
+	}
+}
+
+// specMerger merges specs and remembers the spec defining each name to report collisions
+type specMerger struct {
+	merged  map[string]interface{}
+	origins map[string]string
+}
+
+// names adds the objects of a section of a spec by name, an object defined by two specs must be the same,
+// null objects are missing
+func (m *specMerger) names(file, kind string, merged, objects map[string]interface{}) {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		origin := kind + " " + name
+		if objects[name] == nil {
+			continue
+		}
+		existing, ok := merged[name]
+		if !ok || existing == nil {
+			merged[name] = objects[name]
+			m.origins[origin] = file
+			continue
+		}
+		if !reflect.DeepEqual(existing, objects[name]) {
+			panic(fmt.Errorf("%s of %s collides with %s of %s", origin, file, origin, m.origins[origin]))
+		}
+	}
+}
+
+// channels adds the channels of a spec, the channels defined by two specs are merged if their fields do not collide,
+// so one spec can subscribe to a channel the other one publishes to
+func (m *specMerger) channels(file string, merged, channels map[string]interface{}) {
+	keys := make([]string, 0, len(channels))
+	for key := range channels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		channel, _ := channels[name].(map[string]interface{})
+		existing, ok := merged[name].(map[string]interface{})
+		if !ok {
+			merged[name] = channel
+			for field := range channel {
+				m.origins["channel "+name+" "+field] = file
+			}
+			continue
+		}
+		m.names(file, "channel "+name, existing, channel)
+	}
+}
+
+// section returns a section of the merged spec, creating it if it is missing
+func section(parent map[string]interface{}, name string) map[string]interface{} {
+	value, ok := parent[name].(map[string]interface{})
+	if !ok {
+		value = make(map[string]interface{})
+		parent[name] = value
+	}
+	return value
+}
+
+// merge adds a spec to the merged spec, the fields of the first spec like the info and the id are kept
+func (m *specMerger) merge(file string, document map[string]interface{}) {
+	if m.merged == nil {
+		m.merged = make(map[string]interface{})
+		for key, value := range document {
+			switch {
+			case key == "servers", key == "channels", key == "components", strings.HasPrefix(key, "x-"):
+			default:
+				m.merged[key] = value
+			}
+		}
+	}
+	for key, value := range document {
+		objects, _ := value.(map[string]interface{})
+		switch {
+		case key == "servers":
+			m.names(file, "server", section(m.merged, key), objects)
+		case key == "channels":
+			m.channels(file, section(m.merged, key), objects)
+		case key == "components":
+			components := section(m.merged, key)
+			for kind, objects := range objects {
+				objects, _ := objects.(map[string]interface{})
+				m.names(file, kind, section(components, kind), objects)
+			}
+		case strings.HasPrefix(key, "x-"):
+			m.names(file, "extension", m.merged, map[string]interface{}{key: value})
+		}
+	}
+}
+
+// mergeSpecs parses the specs of the input files and merges their servers, channels, components and extensions,
+// it also returns the spec defining each server
+func mergeSpecs(files []string) (models.AsyncAPI200Schema, map[string]string) {
+	if len(files) == 1 {
+		model, err := models.Parse(files[0])
+		if err != nil {
+			panic(err)
+		}
+		specs := make(map[string]string)
+		for name := range model.Servers {
+			specs[name] = files[0]
+		}
+		return model, specs
+	}
+	m := specMerger{origins: make(map[string]string)}
+	for _, file := range files {
+		document := specDocument(file)
+		directory, err := filepath.Abs(filepath.Dir(file))
+		if err != nil {
+			panic(err)
+		}
+		resolveFiles(document, directory)
+		m.merge(file, document)
+	}
+	data, err := json.Marshal(m.merged)
+	if err != nil {
+		panic(err)
+	}
+	model := models.AsyncAPI200Schema{}
+	err = json.Unmarshal(data, &model)
+	if err != nil {
+		panic(fmt.Errorf("the merged specs are invalid: %v", err))
+	}
+	specs := make(map[string]string)
+	for name := range model.Servers {
+		specs[name] = m.origins["server "+name]
+	}
+	return model, specs
+}
@@ -8,6 +8,7 @@ import (
 
 func TestModels(t *testing.T) {
 	files := [...]string{
+		"../../examples/avro/asyncapi.yml",
 		"../../examples/eftl/asyncapi.yml",
 		"../../examples/eftl/asyncapi_secure.yml",
 		"../../examples/http/asyncapi.yml",
@@ -16,6 +17,10 @@ func TestModels(t *testing.T) {
 		"../../examples/kafka/asyncapi_secure.yml",
 		"../../examples/mqtt/asyncapi.yml",
 		"../../examples/mqtt/asyncapi_secure.yml",
+		"../../examples/mqtt5/asyncapi.yml",
+		"../../examples/oneof/asyncapi.yml",
+		"../../examples/protobuf/asyncapi.yml",
+		"../../examples/service/asyncapi.yml",
 		"../../examples/websocket/asyncapi.yml",
 		"../../examples/websocket/asyncapi_secure.yml",
 		"../../examples/streetlights/streetlights.yml",
@@ -0,0 +1,229 @@
+package transform
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/project-flogo/core/app"
+	"github.com/project-flogo/microgateway"
+)
+
+const (
+	// mainFile is the file of the flogo application of a generated module
+	mainFile = "main.go"
+	// readmeFile is the user owned readme of a generated module
+	readmeFile = "README.md"
+	// coreVersion is the version of the flogo core the generated module requires
+	coreVersion = "v0.9.3-0.20190610180641-336db421a17a"
+)
+
+// moduleVersions are the versions of the modules a generated module requires if no import pins them
+var moduleVersions = map[string]string{
+	"github.com/project-flogo/core":         coreVersion,
+	"github.com/project-flogo/microgateway": MicrogatewayVersion,
+}
+
+// versionLock maps modules to the versions the generated code requires
+type versionLock map[string]string
+
+// readVersionLock reads a version lock file, each line is a module and its version like the requires of a go.mod
+func readVersionLock(path string) versionLock {
+	lock := versionLock{}
+	if path == "" {
+		return lock
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "//"); i >= 0 {
+			text = text[:i]
+		}
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) > 0 && fields[0] == "require" {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 || fields[0] == "(" || fields[0] == ")" || fields[0] == "module" || fields[0] == "go" {
+			continue
+		}
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "v") {
+			panic(fmt.Errorf("%s:%d: invalid version lock %s", path, line, strings.TrimSpace(text)))
+		}
+		lock[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+	return lock
+}
+
+// module returns the locked module of an import path and its version, the longest matching module wins
+func (l versionLock) module(path string) (string, string, bool) {
+	found := ""
+	for module := range l {
+		if (path == module || strings.HasPrefix(path, module+"/")) && len(module) > len(found) {
+			found = module
+		}
+	}
+	return found, l[found], found != ""
+}
+
+// version returns the locked version of the module of an import path, or the given version
+func (l versionLock) version(path, version string) string {
+	if _, locked, ok := l.module(path); ok {
+		return locked
+	}
+	return version
+}
+
+// moduleName returns the module name of an output directory like go mod init
+func moduleName(output string) string {
+	path, err := filepath.Abs(output)
+	if err != nil {
+		panic(err)
+	}
+	name := ""
+	for _, r := range strings.ToLower(filepath.Base(path)) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.') {
+			name += string(r)
+		}
+	}
+	if name == "" || name == "." {
+		name = "app"
+	}
+	return name
+}
+
+// moduleRequires returns the modules of the imports of the generated code and their versions,
+// the locked versions override the versions of the imports and the defaults. The imports without
+// version are reported, and rejected if a version lock file is given
+func moduleRequires(flogo *app.Config, support *supportCode, lock versionLock, lockFile string) map[string]string {
+	requires, unlocked := make(map[string]string), make(map[string]bool)
+	require := func(path, version string) {
+		if module, locked, ok := lock.module(path); ok {
+			requires[module] = locked
+			return
+		}
+		if version != "" {
+			requires[path] = version
+			return
+		}
+		for _, versions := range []map[string]string{moduleVersions, supportModules} {
+			for module, version := range versions {
+				if path == module || strings.HasPrefix(path, module+"/") {
+					requires[module] = version
+					return
+				}
+			}
+		}
+		if strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+			unlocked[path] = true
+		}
+	}
+	for _, port := range flogo.Imports {
+		if parts := strings.SplitN(port, "@", 2); len(parts) == 2 {
+			require(parts[0], strings.SplitN(parts[1], ":", 2)[0])
+			continue
+		}
+		require(port, "")
+	}
+	for _, port := range support.imports {
+		require(port, "")
+	}
+	require("github.com/project-flogo/core/api", "")
+	paths := make([]string, 0, len(unlocked))
+	for path := range unlocked {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if lockFile != "" {
+			panic(fmt.Errorf("%s: the version lock doesn't cover %s", lockFile, path))
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s isn't locked, go mod tidy requires its latest version\n", path)
+	}
+	return requires
+}
+
+// goMod returns the go.mod of a module requiring the modules sorted by path
+func goMod(name string, requires map[string]string) []byte {
+	modules := make([]string, 0, len(requires))
+	for module := range requires {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	mod := fmt.Sprintf("module %s\n\ngo 1.13\n", name)
+	if len(modules) > 0 {
+		mod += "\nrequire (\n"
+		for _, module := range modules {
+			mod += fmt.Sprintf("\t%s %s\n", module, requires[module])
+		}
+		mod += ")\n"
+	}
+	return []byte(mod)
+}
+
+// moduleReadme returns the readme of a generated module
+func moduleReadme(name, input, app string, flogo *app.Config, support *supportCode) []byte {
+	readme := fmt.Sprintf("# %s\n\n", name)
+	if flogo.Description != "" {
+		readme += flogo.Description + "\n\n"
+	}
+	specs := []string{}
+	for _, file := range inputFiles(input) {
+		specs = append(specs, "`"+filepath.Base(file)+"`")
+	}
+	readme += fmt.Sprintf("Generated from %s, this file is created by the generator and then owned by you.\n\n", strings.Join(specs, ", "))
+	readme += "## Build\n\n```bash\ngo mod tidy\ngo build\n```\n\n"
+	readme += "`go mod tidy` resolves the modules without a pinned version and fills `go.sum`.\n\n"
+	readme += fmt.Sprintf("## Run\n\n```bash\n./%s\n```\n\n", name)
+	readme += "## Files\n\n"
+	readme += fmt.Sprintf("* `%s` - the flogo application, regenerated\n", app)
+	readme += fmt.Sprintf("* `%s` - the support code, regenerated\n", generatedFile)
+	for _, name := range support.files {
+		readme += fmt.Sprintf("* `%s` - support code, regenerated\n", name)
+	}
+	readme += "* `go.mod` - the modules pinned by the generator and the version lock, regenerated\n"
+	for _, file := range support.handlerFiles {
+		readme += fmt.Sprintf("* `%s` - your code, kept by regenerations\n", file)
+	}
+	return []byte(readme)
+}
+
+// ToModule converts an async api to a self contained go module of a flogo application
+func ToModule(input, output, role string) {
+	toModule(Config{Input: input, Output: output, Role: role})
+}
+
+func toModule(config Config) {
+	o := config.options()
+	support, flogo := convert(config.Input, o)
+	support.write(config.Output)
+	microgateway.Generate(flogo, filepath.Join(config.Output, layout(config.Layout.App, mainFile)), "")
+
+	name := moduleName(config.Output)
+	err := ioutil.WriteFile(filepath.Join(config.Output, "go.mod"), goMod(name, moduleRequires(flogo, support, o.versions, config.Versions)), 0644)
+	if err != nil {
+		panic(err)
+	}
+	readme := filepath.Join(config.Output, readmeFile)
+	if _, err := os.Stat(readme); os.IsNotExist(err) {
+		err := ioutil.WriteFile(readme, moduleReadme(name, config.Input, layout(config.Layout.App, mainFile), flogo, support), 0644)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
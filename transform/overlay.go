@@ -0,0 +1,395 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/project-flogo/asyncapi/transform/models"
+	"gopkg.in/yaml.v3"
+)
+
+// overlayAction updates or removes the nodes of the spec selected by a JSONPath target
+type overlayAction struct {
+	Target      string      `yaml:"target"`
+	Description string      `yaml:"description"`
+	Update      interface{} `yaml:"update"`
+	Remove      bool        `yaml:"remove"`
+}
+
+// overlay is an overlay document customising a spec without editing it
+type overlay struct {
+	Overlay string                 `yaml:"overlay"`
+	Info    map[string]interface{} `yaml:"info"`
+	Extends string                 `yaml:"extends"`
+	Actions []overlayAction        `yaml:"actions"`
+}
+
+// readOverlay reads an overlay document
+func readOverlay(file string) overlay {
+	reader, err := os.Open(file)
+	if err != nil {
+		panic(err)
+	}
+	defer reader.Close()
+	o := overlay{}
+	decoder := yaml.NewDecoder(reader)
+	decoder.KnownFields(true)
+	err = decoder.Decode(&o)
+	if err != nil {
+		panic(fmt.Errorf("%s: %v", file, err))
+	}
+	if o.Overlay == "" {
+		panic(fmt.Errorf("%s: overlay version is required", file))
+	}
+	for i, action := range o.Actions {
+		if action.Target == "" {
+			panic(fmt.Errorf("%s: action %d has no target", file, i+1))
+		}
+		if action.Update == nil && !action.Remove {
+			panic(fmt.Errorf("%s: action %d neither updates nor removes %s", file, i+1, action.Target))
+		}
+		o.Actions[i].Update = specValue(action.Update)
+	}
+	return o
+}
+
+// applyOverlays applies the actions of the overlays in order to the spec
+func applyOverlays(model *models.AsyncAPI200Schema, files []string) {
+	if len(files) == 0 {
+		return
+	}
+	data, err := json.Marshal(model)
+	if err != nil {
+		panic(err)
+	}
+	var document interface{}
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		for _, action := range readOverlay(file).Actions {
+			path, err := parseJSONPath(action.Target)
+			if err != nil {
+				panic(fmt.Errorf("%s: %v", file, err))
+			}
+			nodes := path.selectNodes(document)
+			if len(nodes) == 0 {
+				fmt.Fprintf(os.Stderr, "warning: overlay %s target %s matches nothing\n", file, action.Target)
+				continue
+			}
+			if action.Remove {
+				document = removeNodes(document, nodes)
+				continue
+			}
+			for _, node := range nodes {
+				document = setNode(document, node, mergeValue(getNode(document, node), action.Update))
+			}
+		}
+	}
+	data, err = json.Marshal(document)
+	if err != nil {
+		panic(err)
+	}
+	updated := models.AsyncAPI200Schema{}
+	err = json.Unmarshal(data, &updated)
+	if err != nil {
+		panic(fmt.Errorf("the overlays make an invalid spec: %v", err))
+	}
+	*model = updated
+}
+
+// mergeValue merges an update into a value, objects are merged recursively, arrays are appended and other values replaced
+func mergeValue(value, update interface{}) interface{} {
+	switch current := value.(type) {
+	case map[string]interface{}:
+		changes, ok := update.(map[string]interface{})
+		if !ok {
+			return update
+		}
+		merged := make(map[string]interface{}, len(current)+len(changes))
+		for key, value := range current {
+			merged[key] = value
+		}
+		for key, change := range changes {
+			merged[key] = mergeValue(current[key], change)
+		}
+		return merged
+	case []interface{}:
+		return append(append([]interface{}{}, current...), update)
+	}
+	return update
+}
+
+// jsonPathSegment is a step of a JSONPath selecting the children of a node
+type jsonPathSegment struct {
+	recursive bool
+	wildcard  bool
+	name      string
+	index     *int
+	filter    *jsonPathFilter
+}
+
+// jsonPathFilter selects the children with a property, or with a property equal or not to a value
+type jsonPathFilter struct {
+	property []string
+	operator string
+	value    interface{}
+}
+
+// jsonPath is a parsed JSONPath
+type jsonPath []jsonPathSegment
+
+// parseJSONPath parses a JSONPath like $.channels['light/on'].subscribe or $..message[?(@.name == 'dim')]
+func parseJSONPath(target string) (jsonPath, error) {
+	if !strings.HasPrefix(target, "$") {
+		return nil, fmt.Errorf("target %s does not start with $", target)
+	}
+	path, rest := jsonPath{}, target[1:]
+	for rest != "" {
+		segment := jsonPathSegment{}
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			segment.recursive, rest = true, rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("target %s has an empty name", target)
+			}
+			segment.name, segment.wildcard, rest = name, name == "*", rest[end:]
+			path = append(path, segment)
+			continue
+		case !strings.HasPrefix(rest, "["):
+			return nil, fmt.Errorf("target %s is invalid at %s", target, rest)
+		}
+		end, quote := -1, rune(0)
+		for i, r := range rest {
+			if quote != 0 {
+				if r == quote {
+					quote = 0
+				}
+				continue
+			}
+			if r == '\'' || r == '"' {
+				quote = r
+			} else if r == ']' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("target %s has an unclosed [", target)
+		}
+		selector := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+		switch {
+		case selector == "*":
+			segment.wildcard = true
+		case strings.HasPrefix(selector, "?(") && strings.HasSuffix(selector, ")"):
+			filter, err := parseJSONPathFilter(selector[2 : len(selector)-1])
+			if err != nil {
+				return nil, fmt.Errorf("target %s: %v", target, err)
+			}
+			segment.filter = filter
+		case len(selector) > 1 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+			segment.name = selector[1 : len(selector)-1]
+		default:
+			index, err := strconv.Atoi(selector)
+			if err != nil {
+				return nil, fmt.Errorf("target %s has an invalid selector %s", target, selector)
+			}
+			segment.index = &index
+		}
+		path = append(path, segment)
+	}
+	return path, nil
+}
+
+// parseJSONPathFilter parses a filter expression like @.name == 'dim'
+func parseJSONPathFilter(expression string) (*jsonPathFilter, error) {
+	filter := &jsonPathFilter{}
+	left := strings.TrimSpace(expression)
+	for _, operator := range []string{"==", "!="} {
+		if i := strings.Index(expression, operator); i >= 0 {
+			left, filter.operator = strings.TrimSpace(expression[:i]), operator
+			value := strings.TrimSpace(expression[i+len(operator):])
+			if len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'' {
+				value = strconv.Quote(value[1 : len(value)-1])
+			}
+			if err := json.Unmarshal([]byte(value), &filter.value); err != nil {
+				return nil, fmt.Errorf("invalid filter value %s", value)
+			}
+			break
+		}
+	}
+	if !strings.HasPrefix(left, "@.") {
+		return nil, fmt.Errorf("invalid filter %s", expression)
+	}
+	filter.property = strings.Split(left[2:], ".")
+	return filter, nil
+}
+
+// match returns true if a node matches the filter
+func (f *jsonPathFilter) match(node interface{}) bool {
+	for _, name := range f.property {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if node, ok = object[name]; !ok {
+			return false
+		}
+	}
+	switch f.operator {
+	case "==":
+		return fmt.Sprint(node) == fmt.Sprint(f.value)
+	case "!=":
+		return fmt.Sprint(node) != fmt.Sprint(f.value)
+	}
+	return true
+}
+
+// children returns the keys of the children of a node, the names of an object are sorted
+func children(node interface{}) []interface{} {
+	keys := []interface{}{}
+	switch node := node.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(node))
+		for name := range node {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			keys = append(keys, name)
+		}
+	case []interface{}:
+		for i := range node {
+			keys = append(keys, i)
+		}
+	}
+	return keys
+}
+
+// child returns the child of a node by key
+func child(node, key interface{}) interface{} {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		return node[key.(string)]
+	case []interface{}:
+		return node[key.(int)]
+	}
+	return nil
+}
+
+// descendants returns the paths of a node and of all its descendants
+func descendants(node interface{}, path []interface{}) [][]interface{} {
+	paths := [][]interface{}{path}
+	for _, key := range children(node) {
+		paths = append(paths, descendants(child(node, key), append(append([]interface{}{}, path...), key))...)
+	}
+	return paths
+}
+
+// selectNodes returns the paths of the nodes of the document selected by the JSONPath
+func (p jsonPath) selectNodes(document interface{}) [][]interface{} {
+	paths := [][]interface{}{{}}
+	for _, segment := range p {
+		if segment.recursive {
+			expanded := [][]interface{}{}
+			for _, path := range paths {
+				expanded = append(expanded, descendants(getNode(document, path), path)...)
+			}
+			paths = expanded
+		}
+		selected := [][]interface{}{}
+		for _, path := range paths {
+			node := getNode(document, path)
+			for _, key := range children(node) {
+				switch {
+				case segment.wildcard:
+				case segment.filter != nil:
+					if !segment.filter.match(child(node, key)) {
+						continue
+					}
+				case segment.index != nil:
+					index, ok := key.(int)
+					length := len(children(node))
+					if !ok || (index != *segment.index && index != length+*segment.index) {
+						continue
+					}
+				default:
+					if name, ok := key.(string); !ok || name != segment.name {
+						continue
+					}
+				}
+				selected = append(selected, append(append([]interface{}{}, path...), key))
+			}
+		}
+		paths = selected
+	}
+	return paths
+}
+
+// getNode returns the node of the document at a path
+func getNode(document interface{}, path []interface{}) interface{} {
+	node := document
+	for _, key := range path {
+		node = child(node, key)
+	}
+	return node
+}
+
+// setNode replaces the node of the document at a path and returns the document
+func setNode(document interface{}, path []interface{}, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+	switch parent := getNode(document, path[:len(path)-1]).(type) {
+	case map[string]interface{}:
+		parent[path[len(path)-1].(string)] = value
+	case []interface{}:
+		parent[path[len(path)-1].(int)] = value
+	}
+	return document
+}
+
+// removeNodes removes the nodes of the document at the paths and returns the document,
+// the elements of arrays are removed from the last one so the indexes of the others hold
+func removeNodes(document interface{}, paths [][]interface{}) interface{} {
+	sort.SliceStable(paths, func(i, j int) bool {
+		a, b := paths[i], paths[j]
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		x, xIndex := a[len(a)-1].(int)
+		y, yIndex := b[len(b)-1].(int)
+		return xIndex && yIndex && x > y
+	})
+	for _, path := range paths {
+		if len(path) == 0 {
+			panic(fmt.Errorf("an overlay can not remove the spec"))
+		}
+		parentPath, key := path[:len(path)-1], path[len(path)-1]
+		switch parent := getNode(document, parentPath).(type) {
+		case map[string]interface{}:
+			delete(parent, key.(string))
+		case []interface{}:
+			index := key.(int)
+			document = setNode(document, parentPath, append(append([]interface{}{}, parent[:index]...), parent[index+1:]...))
+		}
+	}
+	return document
+}
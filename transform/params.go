@@ -0,0 +1,229 @@
+package transform
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// channelParameter is a parameter of a channel
+type channelParameter struct {
+	name    string
+	typ     string
+	enum    []string
+	source  string
+	pointer string
+}
+
+// parameterLocation parses a runtime expression like $message.payload#/user/id
+func parameterLocation(location string) (source, pointer string) {
+	parts := strings.SplitN(location, "#", 2)
+	switch parts[0] {
+	case "$message.payload":
+		source = "message"
+	case "$message.header":
+		source = "headers"
+	default:
+		panic(fmt.Errorf("invalid parameter location %s", location))
+	}
+	if len(parts) == 2 {
+		pointer = parts[1]
+	}
+	return source, pointer
+}
+
+// channelParameters returns the parameters of the channel in the order they appear
+func channelParameters(s settings) []channelParameter {
+	chunks, _ := parseURL(s.topic)
+	var parameters []channelParameter
+	for _, chunk := range chunks {
+		if chunk.value != "" {
+			continue
+		}
+		parameter := channelParameter{
+			name: chunk.name,
+			typ:  "string",
+		}
+		if value := s.parameters[chunk.name]; value != nil {
+			if schema, ok := value.Schema.(map[string]interface{}); ok {
+				if typ, ok := schema["type"].(string); ok {
+					parameter.typ = typ
+				}
+				if enum, ok := schema["enum"].([]interface{}); ok {
+					for _, value := range enum {
+						parameter.enum = append(parameter.enum, fmt.Sprint(value))
+					}
+				}
+			}
+			if value.Location != "" {
+				parameter.source, parameter.pointer = parameterLocation(value.Location)
+			}
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters
+}
+
+// receivedParameters returns the parameters of the channel the handlers can extract, a parameter without a location
+// can't be extracted if the trigger doesn't output the channel parameters
+func receivedParameters(s settings) []channelParameter {
+	var parameters []channelParameter
+	for _, parameter := range channelParameters(s) {
+		if parameter.source == "" && s.paramsPath == "" {
+			fmt.Fprintf(os.Stderr, "warning: channel %s: parameter %s has no location and the %s trigger of server %s doesn't receive the channel parameters, it is not extracted\n",
+				s.topic, parameter.name, s.name, s.serverName)
+			continue
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters
+}
+
+// writeParamsExtractor writes a method converting and validating the parameters of each channel
+func writeParamsExtractor(support *supportCode, name string, params map[string][]channelParameter) {
+	support.addImport("encoding/json")
+	support.addImport("fmt")
+	support.addImport("strconv")
+	support.addImport("strings")
+
+	channels := make([]string, 0, len(params))
+	for channel := range params {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	fmt.Fprintf(support, "type %sChannelParameter struct {\n", name)
+	fmt.Fprintf(support, "\tname    string\n")
+	fmt.Fprintf(support, "\ttyp     string\n")
+	fmt.Fprintf(support, "\tenum    []string\n")
+	fmt.Fprintf(support, "\tsource  string\n")
+	fmt.Fprintf(support, "\tpointer string\n")
+	fmt.Fprintf(support, "}\n")
+	fmt.Fprintf(support, "var %sParameters = map[string][]%sChannelParameter{\n", name, name)
+	for _, channel := range channels {
+		fmt.Fprintf(support, "\t%q: {\n", channel)
+		for _, parameter := range params[channel] {
+			fmt.Fprintf(support, "\t\t{name: %q, typ: %q, enum: %#v, source: %q, pointer: %q},\n",
+				parameter.name, parameter.typ, parameter.enum, parameter.source, parameter.pointer)
+		}
+		fmt.Fprintf(support, "\t},\n")
+	}
+	fmt.Fprintf(support, "}\n")
+	fmt.Fprintf(support, paramsExtractor, name)
+	fmt.Fprintf(support, "func init() {\n")
+	fmt.Fprintf(support, "\tmethodinvoker.RegisterMethods(\"%sParams\", %sParams)\n", name, name)
+	fmt.Fprintf(support, "}\n")
+}
+
+const paramsExtractor = `func %[1]sParams(inputs interface{}) (map[string]interface{}, error) {
+	values, _ := inputs.(map[string]interface{})
+	channel, _ := values["channel"].(string)
+	outputs := make(map[string]interface{}, len(values)+2)
+	for key, value := range values {
+		outputs[key] = value
+	}
+	invalid := func(format string, a ...interface{}) (map[string]interface{}, error) {
+		outputs["valid"], outputs["error"] = false, fmt.Sprintf(format, a...)
+		return outputs, nil
+	}
+	raw := make(map[string]string)
+	switch params := values["params"].(type) {
+	case map[string]string:
+		raw = params
+	case map[string]interface{}:
+		for key, value := range params {
+			raw[key] = fmt.Sprint(value)
+		}
+	}
+	lookup := func(source, pointer string) (interface{}, bool) {
+		var value interface{}
+		switch document := values[source].(type) {
+		case string:
+			if err := json.Unmarshal([]byte(document), &value); err != nil {
+				return nil, false
+			}
+		case []byte:
+			if err := json.Unmarshal(document, &value); err != nil {
+				return nil, false
+			}
+		default:
+			value = document
+		}
+		for _, token := range strings.Split(pointer, "/") {
+			if token == "" {
+				continue
+			}
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			switch container := value.(type) {
+			case map[string]interface{}:
+				next, ok := container[token]
+				if !ok {
+					return nil, false
+				}
+				value = next
+			case map[string]string:
+				next, ok := container[token]
+				if !ok {
+					return nil, false
+				}
+				value = next
+			case []interface{}:
+				index, err := strconv.Atoi(token)
+				if err != nil || index < 0 || index >= len(container) {
+					return nil, false
+				}
+				value = container[index]
+			default:
+				return nil, false
+			}
+		}
+		return value, value != nil
+	}
+	params := make(map[string]interface{})
+	for _, parameter := range %[1]sParameters[channel] {
+		var value string
+		if parameter.source != "" {
+			found, ok := lookup(parameter.source, parameter.pointer)
+			if !ok {
+				return invalid("missing parameter %%s", parameter.name)
+			}
+			value = fmt.Sprint(found)
+		} else {
+			found, ok := raw[parameter.name]
+			if !ok {
+				return invalid("missing parameter %%s", parameter.name)
+			}
+			value = found
+		}
+		var typed interface{} = value
+		var err error
+		switch parameter.typ {
+		case "integer":
+			typed, err = strconv.ParseInt(value, 10, 64)
+		case "number":
+			typed, err = strconv.ParseFloat(value, 64)
+		case "boolean":
+			typed, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			return invalid("parameter %%s is not a %%s", parameter.name, parameter.typ)
+		}
+		if len(parameter.enum) > 0 {
+			found := false
+			for _, allowed := range parameter.enum {
+				if allowed == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return invalid("parameter %%s has an invalid value %%s", parameter.name, value)
+			}
+		}
+		params[parameter.name] = typed
+	}
+	outputs["params"], outputs["valid"] = params, true
+	return outputs, nil
+}
+`
@@ -0,0 +1,538 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// isProtobuf returns true if the schema format is a protobuf definition
+func isProtobuf(schemaFormat string) bool {
+	schemaFormat = strings.ToLower(schemaFormat)
+	return strings.HasPrefix(schemaFormat, "application/vnd.google.protobuf") ||
+		strings.HasPrefix(schemaFormat, "application/x-protobuf")
+}
+
+// protoField is a field of a protobuf message, the types are scalars, enum or message names
+type protoField struct {
+	name     string
+	typ      string
+	key      string
+	number   int
+	repeated bool
+}
+
+// protoMessage is a protobuf message
+type protoMessage struct {
+	name   string
+	fields []protoField
+}
+
+// protoFile is a parsed protobuf definition
+type protoFile struct {
+	pkg      string
+	messages []*protoMessage
+	names    map[string]*protoMessage
+}
+
+// parseProto compiles the protobuf definition name, its imports are read from the directory
+func parseProto(name, source, directory string) *protoFile {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: func(path string) (io.ReadCloser, error) {
+				if path == name {
+					return ioutil.NopCloser(strings.NewReader(source)), nil
+				}
+				return os.Open(filepath.Join(directory, path))
+			},
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), name)
+	if err != nil {
+		panic(fmt.Errorf("invalid proto definition: %v", err))
+	}
+	descriptor := files[0]
+	file := &protoFile{
+		pkg:   string(descriptor.Package()),
+		names: make(map[string]*protoMessage),
+	}
+	file.walk(descriptor.Messages())
+	return file
+}
+
+// protoName returns the name of a message without its package
+func protoName(descriptor protoreflect.Descriptor) string {
+	name := string(descriptor.FullName())
+	if pkg := descriptor.ParentFile().Package(); pkg != "" {
+		name = strings.TrimPrefix(name, string(pkg)+".")
+	}
+	return name
+}
+
+// protoKind returns the type of a field, enums are enum and messages are their names
+func protoKind(field protoreflect.FieldDescriptor) string {
+	switch field.Kind() {
+	case protoreflect.EnumKind:
+		return "enum"
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return protoName(field.Message())
+	}
+	return field.Kind().String()
+}
+
+// message converts a message descriptor and the messages its fields reference
+func (f *protoFile) message(descriptor protoreflect.MessageDescriptor) *protoMessage {
+	name := protoName(descriptor)
+	if message, ok := f.names[name]; ok {
+		return message
+	}
+	message := &protoMessage{
+		name: name,
+	}
+	f.names[name] = message
+	fields := descriptor.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		converted := protoField{
+			name:     string(field.Name()),
+			typ:      protoKind(field),
+			number:   int(field.Number()),
+			repeated: field.IsList(),
+		}
+		if field.IsMap() {
+			converted.key = protoKind(field.MapKey())
+			converted.typ = protoKind(field.MapValue())
+			field = field.MapValue()
+		}
+		if referenced := field.Message(); referenced != nil {
+			f.message(referenced)
+		}
+		message.fields = append(message.fields, converted)
+	}
+	return message
+}
+
+// walk adds the messages and their nested messages in the order they are declared
+func (f *protoFile) walk(descriptors protoreflect.MessageDescriptors) {
+	for i := 0; i < descriptors.Len(); i++ {
+		descriptor := descriptors.Get(i)
+		if descriptor.IsMapEntry() {
+			continue
+		}
+		f.messages = append(f.messages, f.message(descriptor))
+		f.walk(descriptor.Messages())
+	}
+}
+
+// protoScalars maps the protobuf scalar types to go types
+var protoScalars = map[string]string{
+	"double":   "float64",
+	"float":    "float32",
+	"int32":    "int32",
+	"int64":    "int64",
+	"uint32":   "uint32",
+	"uint64":   "uint64",
+	"sint32":   "int32",
+	"sint64":   "int64",
+	"fixed32":  "uint32",
+	"fixed64":  "uint64",
+	"sfixed32": "int32",
+	"sfixed64": "int64",
+	"bool":     "bool",
+	"string":   "string",
+	"bytes":    "[]byte",
+}
+
+// protoGoName converts the full name of a message to a go name
+func protoGoName(name string) string {
+	converted := ""
+	for _, part := range strings.Split(name, ".") {
+		converted += goName(part)
+	}
+	return converted
+}
+
+// protoWire returns the wire type of a type
+func protoWire(typ string) string {
+	switch typ {
+	case "fixed32", "sfixed32", "float":
+		return "protowire.Fixed32Type"
+	case "fixed64", "sfixed64", "double":
+		return "protowire.Fixed64Type"
+	case "string", "bytes":
+		return "protowire.BytesType"
+	case "enum":
+		return "protowire.VarintType"
+	}
+	if _, ok := protoScalars[typ]; ok {
+		return "protowire.VarintType"
+	}
+	return "protowire.BytesType"
+}
+
+// protoGoType returns the go type of a type
+func protoGoType(typ string) string {
+	if scalar, ok := protoScalars[typ]; ok {
+		return scalar
+	}
+	if typ == "enum" {
+		return "int32"
+	}
+	return "*" + protoGoName(typ)
+}
+
+// protoAppend returns the expression appending the value x to the buffer
+func protoAppend(file *supportCode, buffer, typ, x string) string {
+	switch typ {
+	case "int32", "int64", "uint32", "uint64", "enum":
+		return fmt.Sprintf("protowire.AppendVarint(%s, uint64(%s))", buffer, x)
+	case "bool":
+		return fmt.Sprintf("protowire.AppendVarint(%s, protowire.EncodeBool(%s))", buffer, x)
+	case "sint32", "sint64":
+		return fmt.Sprintf("protowire.AppendVarint(%s, protowire.EncodeZigZag(int64(%s)))", buffer, x)
+	case "fixed32", "sfixed32":
+		return fmt.Sprintf("protowire.AppendFixed32(%s, uint32(%s))", buffer, x)
+	case "fixed64", "sfixed64":
+		return fmt.Sprintf("protowire.AppendFixed64(%s, uint64(%s))", buffer, x)
+	case "float":
+		file.addImport("math")
+		return fmt.Sprintf("protowire.AppendFixed32(%s, math.Float32bits(%s))", buffer, x)
+	case "double":
+		file.addImport("math")
+		return fmt.Sprintf("protowire.AppendFixed64(%s, math.Float64bits(%s))", buffer, x)
+	case "string":
+		return fmt.Sprintf("protowire.AppendString(%s, %s)", buffer, x)
+	case "bytes":
+		return fmt.Sprintf("protowire.AppendBytes(%s, %s)", buffer, x)
+	}
+	return fmt.Sprintf("protowire.AppendBytes(%s, %s.MarshalProto())", buffer, x)
+}
+
+// protoIsSet returns the expression checking that the value x is not the default value
+func protoIsSet(typ, x string) string {
+	switch typ {
+	case "bool":
+		return x
+	case "string":
+		return x + ` != ""`
+	case "bytes":
+		return "len(" + x + ") > 0"
+	}
+	if _, ok := protoScalars[typ]; ok || typ == "enum" {
+		return x + " != 0"
+	}
+	return x + " != nil"
+}
+
+// protoDecode returns the statements assigning the decoded value v or b to the target
+func protoDecode(file *supportCode, typ, target string, repeated bool, indent string) string {
+	value := ""
+	switch typ {
+	case "int32", "enum":
+		value = "int32(v)"
+	case "int64":
+		value = "int64(v)"
+	case "uint32", "fixed32":
+		value = "uint32(v)"
+	case "uint64", "fixed64":
+		value = "v"
+	case "bool":
+		value = "v != 0"
+	case "sint32":
+		value = "int32(protowire.DecodeZigZag(v))"
+	case "sint64":
+		value = "protowire.DecodeZigZag(v)"
+	case "sfixed32":
+		value = "int32(uint32(v))"
+	case "sfixed64":
+		value = "int64(v)"
+	case "float":
+		file.addImport("math")
+		value = "math.Float32frombits(uint32(v))"
+	case "double":
+		file.addImport("math")
+		value = "math.Float64frombits(v)"
+	case "string":
+		value = "string(b)"
+	case "bytes":
+		value = "append([]byte(nil), b...)"
+	}
+	code := ""
+	if value == "" {
+		code += fmt.Sprintf("%sitem := &%s{}\n", indent, protoGoName(typ))
+		code += fmt.Sprintf("%sif e := item.UnmarshalProto(b); e != nil {\n", indent)
+		code += fmt.Sprintf("%s\terr = e\n", indent)
+		code += fmt.Sprintf("%s}\n", indent)
+		value = "item"
+	}
+	if repeated {
+		return code + fmt.Sprintf("%s%s = append(%s, %s)\n", indent, target, target, value)
+	}
+	return code + fmt.Sprintf("%s%s = %s\n", indent, target, value)
+}
+
+// writeProtoMessage writes the go type of a protobuf message and of the messages it references
+func writeProtoMessage(support, file *supportCode, definition *protoFile, message *protoMessage) string {
+	typ := protoGoName(message.name)
+	if !support.once("type:" + typ) {
+		return typ
+	}
+	fields := message.fields
+
+	fmt.Fprintf(file, "type %s struct {\n", typ)
+	for _, field := range fields {
+		goType := protoGoType(field.typ)
+		switch {
+		case field.key != "":
+			goType = fmt.Sprintf("map[%s]%s", protoGoType(field.key), goType)
+		case field.repeated:
+			goType = "[]" + goType
+		}
+		fmt.Fprintf(file, "\t%s %s `json:%q`\n", goName(field.name), goType, field.name)
+	}
+	fmt.Fprintf(file, "}\n")
+
+	fmt.Fprintf(file, "func (m *%s) MarshalProto() []byte {\n", typ)
+	fmt.Fprintf(file, "\tif m == nil {\n\t\treturn nil\n\t}\n")
+	fmt.Fprintf(file, "\tvar b []byte\n")
+	for _, field := range fields {
+		name, wire := "m."+goName(field.name), protoWire(field.typ)
+		switch {
+		case field.key != "":
+			fmt.Fprintf(file, "\tfor key, value := range %s {\n", name)
+			fmt.Fprintf(file, "\t\tvar entry []byte\n")
+			fmt.Fprintf(file, "\t\tentry = protowire.AppendTag(entry, 1, %s)\n", protoWire(field.key))
+			fmt.Fprintf(file, "\t\tentry = %s\n", protoAppend(file, "entry", field.key, "key"))
+			fmt.Fprintf(file, "\t\tentry = protowire.AppendTag(entry, 2, %s)\n", wire)
+			fmt.Fprintf(file, "\t\tentry = %s\n", protoAppend(file, "entry", field.typ, "value"))
+			fmt.Fprintf(file, "\t\tb = protowire.AppendTag(b, %d, protowire.BytesType)\n", field.number)
+			fmt.Fprintf(file, "\t\tb = protowire.AppendBytes(b, entry)\n")
+			fmt.Fprintf(file, "\t}\n")
+		case field.repeated && wire != "protowire.BytesType":
+			fmt.Fprintf(file, "\tif len(%s) > 0 {\n", name)
+			fmt.Fprintf(file, "\t\tvar packed []byte\n")
+			fmt.Fprintf(file, "\t\tfor _, x := range %s {\n", name)
+			fmt.Fprintf(file, "\t\t\tpacked = %s\n", protoAppend(file, "packed", field.typ, "x"))
+			fmt.Fprintf(file, "\t\t}\n")
+			fmt.Fprintf(file, "\t\tb = protowire.AppendTag(b, %d, protowire.BytesType)\n", field.number)
+			fmt.Fprintf(file, "\t\tb = protowire.AppendBytes(b, packed)\n")
+			fmt.Fprintf(file, "\t}\n")
+		case field.repeated:
+			fmt.Fprintf(file, "\tfor _, x := range %s {\n", name)
+			fmt.Fprintf(file, "\t\tb = protowire.AppendTag(b, %d, %s)\n", field.number, wire)
+			fmt.Fprintf(file, "\t\tb = %s\n", protoAppend(file, "b", field.typ, "x"))
+			fmt.Fprintf(file, "\t}\n")
+		default:
+			fmt.Fprintf(file, "\tif %s {\n", protoIsSet(field.typ, name))
+			fmt.Fprintf(file, "\t\tb = protowire.AppendTag(b, %d, %s)\n", field.number, wire)
+			fmt.Fprintf(file, "\t\tb = %s\n", protoAppend(file, "b", field.typ, name))
+			fmt.Fprintf(file, "\t}\n")
+		}
+	}
+	fmt.Fprintf(file, "\treturn b\n")
+	fmt.Fprintf(file, "}\n")
+
+	fmt.Fprintf(file, "func (m *%s) UnmarshalProto(data []byte) error {\n", typ)
+	fmt.Fprintf(file, "\tvar err error\n")
+	fmt.Fprintf(file, "\tparse := protoFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {\n")
+	fmt.Fprintf(file, "\t\tswitch num {\n")
+	for _, field := range fields {
+		name, wire := "m."+goName(field.name), protoWire(field.typ)
+		fmt.Fprintf(file, "\t\tcase %d:\n", field.number)
+		if field.key != "" {
+			fmt.Fprintf(file, "\t\t\treturn protoField(typ, protowire.BytesType, data, func(v uint64, b []byte) {\n")
+			fmt.Fprintf(file, "\t\t\t\tvar key %s\n", protoGoType(field.key))
+			fmt.Fprintf(file, "\t\t\t\tvar value %s\n", protoGoType(field.typ))
+			fmt.Fprintf(file, "\t\t\t\tif e := protoFields(b, func(num protowire.Number, typ protowire.Type, data []byte) int {\n")
+			fmt.Fprintf(file, "\t\t\t\t\tswitch num {\n")
+			fmt.Fprintf(file, "\t\t\t\t\tcase 1:\n")
+			fmt.Fprintf(file, "\t\t\t\t\t\treturn protoField(typ, %s, data, func(v uint64, b []byte) {\n", protoWire(field.key))
+			fmt.Fprintf(file, "%s", protoDecode(file, field.key, "key", false, "\t\t\t\t\t\t\t"))
+			fmt.Fprintf(file, "\t\t\t\t\t\t})\n")
+			fmt.Fprintf(file, "\t\t\t\t\tcase 2:\n")
+			fmt.Fprintf(file, "\t\t\t\t\t\treturn protoField(typ, %s, data, func(v uint64, b []byte) {\n", wire)
+			fmt.Fprintf(file, "%s", protoDecode(file, field.typ, "value", false, "\t\t\t\t\t\t\t"))
+			fmt.Fprintf(file, "\t\t\t\t\t\t})\n")
+			fmt.Fprintf(file, "\t\t\t\t\t}\n")
+			fmt.Fprintf(file, "\t\t\t\t\treturn protowire.ConsumeFieldValue(num, typ, data)\n")
+			fmt.Fprintf(file, "\t\t\t\t}); e != nil {\n")
+			fmt.Fprintf(file, "\t\t\t\t\terr = e\n")
+			fmt.Fprintf(file, "\t\t\t\t}\n")
+			fmt.Fprintf(file, "\t\t\t\tif %s == nil {\n", name)
+			fmt.Fprintf(file, "\t\t\t\t\t%s = make(map[%s]%s)\n", name, protoGoType(field.key), protoGoType(field.typ))
+			fmt.Fprintf(file, "\t\t\t\t}\n")
+			fmt.Fprintf(file, "\t\t\t\t%s[key] = value\n", name)
+			fmt.Fprintf(file, "\t\t\t})\n")
+			continue
+		}
+		fmt.Fprintf(file, "\t\t\treturn protoField(typ, %s, data, func(v uint64, b []byte) {\n", wire)
+		fmt.Fprintf(file, "%s", protoDecode(file, field.typ, name, field.repeated, "\t\t\t\t"))
+		fmt.Fprintf(file, "\t\t\t})\n")
+	}
+	fmt.Fprintf(file, "\t\t}\n")
+	fmt.Fprintf(file, "\t\treturn protowire.ConsumeFieldValue(num, typ, data)\n")
+	fmt.Fprintf(file, "\t})\n")
+	fmt.Fprintf(file, "\tif parse != nil {\n\t\treturn parse\n\t}\n")
+	fmt.Fprintf(file, "\treturn err\n")
+	fmt.Fprintf(file, "}\n")
+
+	fmt.Fprintf(file, "func Decode%s(message interface{}) (*%s, error) {\n", typ, typ)
+	fmt.Fprintf(file, "\tvalue := &%s{}\n", typ)
+	fmt.Fprintf(file, "\treturn value, convertMessage(message, value)\n")
+	fmt.Fprintf(file, "}\n")
+
+	for _, field := range fields {
+		if referenced, ok := definition.names[field.typ]; ok {
+			writeProtoMessage(support, file, definition, referenced)
+		}
+	}
+	return typ
+}
+
+// protoType writes the go types of the protobuf message to proto.go and returns the go type of the message
+func protoType(support *supportCode, s settings) string {
+	name, directory := "payload.proto", s.directory
+	source, ok := s.message["payload"].(string)
+	if !ok {
+		path := s.messageField("x-proto-file")
+		if path == "" {
+			panic(fmt.Errorf("protobuf message of channel %s has no definition", s.topic))
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.directory, path)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+		source = string(data)
+		name, directory = filepath.Base(path), filepath.Dir(path)
+	}
+	definition := parseProto(name, source, directory)
+	if len(definition.messages) == 0 {
+		panic(fmt.Errorf("protobuf definition of channel %s has no messages", s.topic))
+	}
+	message := definition.messages[0]
+	if value := s.messageField("x-proto-message"); value != "" {
+		full := strings.TrimPrefix(value, ".")
+		if definition.pkg != "" {
+			full = strings.TrimPrefix(full, definition.pkg+".")
+		}
+		message, ok = definition.names[full]
+		if !ok {
+			panic(fmt.Errorf("%s of channel %s is not a message", value, s.topic))
+		}
+	}
+
+	file := support.file("proto.go")
+	file.addImport("google.golang.org/protobuf/encoding/protowire")
+	typ := writeProtoMessage(support, file, definition, message)
+
+	support.addImport("fmt")
+	support.addImport("google.golang.org/protobuf/encoding/protowire")
+	support.writeOnce("proto", protoSupport)
+	return typ
+}
+
+// writeProtoCodec writes the go types of the protobuf message to proto.go and registers its codec
+func writeProtoCodec(support *supportCode, name string, s settings) {
+	typ := protoType(support, s)
+	fmt.Fprintf(support, "func init() {\n")
+	fmt.Fprintf(support, "\tregisterProto(%q, func() protoMessage {\n", name)
+	fmt.Fprintf(support, "\t\treturn &%s{}\n", typ)
+	fmt.Fprintf(support, "\t})\n")
+	fmt.Fprintf(support, "}\n")
+}
+
+const protoSupport = `type protoMessage interface {
+	MarshalProto() []byte
+	UnmarshalProto(data []byte) error
+}
+type protoCodec struct {
+	message func() protoMessage
+}
+func registerProto(name string, message func() protoMessage) {
+	schemaCodecs[name] = &protoCodec{message: message}
+}
+func (p *protoCodec) decode(data []byte) (interface{}, error) {
+	message := p.message()
+	if err := message.UnmarshalProto(data); err != nil {
+		return nil, fmt.Errorf("invalid protobuf message: %v", err)
+	}
+	var value interface{}
+	return value, convertMessage(message, &value)
+}
+func (p *protoCodec) encode(message interface{}) (interface{}, error) {
+	typed, ok := message.(protoMessage)
+	if !ok {
+		typed = p.message()
+		if err := convertMessage(message, typed); err != nil {
+			return nil, fmt.Errorf("invalid protobuf message: %v", err)
+		}
+	}
+	return string(typed.MarshalProto()), nil
+}
+func protoFields(data []byte, field func(num protowire.Number, typ protowire.Type, data []byte) int) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		n = field(num, typ, data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+func protoField(typ, wire protowire.Type, data []byte, value func(v uint64, b []byte)) int {
+	if typ == protowire.BytesType && wire != protowire.BytesType {
+		packed, n := protowire.ConsumeBytes(data)
+		for n >= 0 && len(packed) > 0 {
+			m := protoField(wire, wire, packed, value)
+			if m < 0 {
+				return m
+			}
+			packed = packed[m:]
+		}
+		return n
+	}
+	if typ != wire {
+		return protowire.ConsumeFieldValue(0, typ, data)
+	}
+	switch wire {
+	case protowire.VarintType:
+		v, n := protowire.ConsumeVarint(data)
+		if n >= 0 {
+			value(v, nil)
+		}
+		return n
+	case protowire.Fixed32Type:
+		v, n := protowire.ConsumeFixed32(data)
+		if n >= 0 {
+			value(uint64(v), nil)
+		}
+		return n
+	case protowire.Fixed64Type:
+		v, n := protowire.ConsumeFixed64(data)
+		if n >= 0 {
+			value(v, nil)
+		}
+		return n
+	}
+	b, n := protowire.ConsumeBytes(data)
+	if n >= 0 {
+		value(0, b)
+	}
+	return n
+}
+`
@@ -2,7 +2,6 @@ package transform
 
 import (
 	"fmt"
-	"strings"
 )
 
 var protocolEFTL = protocolConfig{
@@ -16,6 +15,8 @@ var protocolEFTL = protocolConfig{
 	activityVersion: "v0.0.0-20190709194620-9c397d37ddf5",
 	port:            9097,
 	contentPath:     "content",
+	serviceInput:    "content",
+	destination:     destinationRules{separator: "_"},
 	triggerSettings: func(s settings) map[string]interface{} {
 		settings := map[string]interface{}{
 			"id":  fmt.Sprintf("%s%s", s.name, s.serverName),
@@ -31,20 +32,16 @@ var protocolEFTL = protocolConfig{
 		return settings
 	},
 	handlerSettings: func(s settings) map[string]interface{} {
-		parts := strings.Split(s.topic[1:], "/")
-		topic := strings.Join(parts, "_")
 		settings := map[string]interface{}{
-			"dest": topic,
+			"dest": s.destination,
 		}
 		return settings
 	},
 	serviceSettings: func(s settings) map[string]interface{} {
-		parts := strings.Split(s.topic[1:], "/")
-		topic := strings.Join(parts, "_")
 		settings := map[string]interface{}{
 			"id":   fmt.Sprintf("%s%s", s.name, s.topic),
 			"url":  s.url,
-			"dest": topic,
+			"dest": s.destination,
 		}
 		if s.userPassword {
 			settings["user"] = s.user
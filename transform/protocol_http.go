@@ -2,8 +2,31 @@ package transform
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/project-flogo/microgateway/api"
 )
 
+// httpMethod returns the method of the http operation binding
+func httpMethod(s settings) string {
+	method := ""
+	if http := s.binding("http"); http != nil {
+		if value, ok := schemaValue(http["method"]); ok {
+			if value, ok := value.(string); ok {
+				method = strings.ToUpper(value)
+			}
+		}
+	}
+	if http := s.binding("flogo-http"); http != nil {
+		if value := http["method"]; value != nil {
+			if value, ok := value.(string); ok {
+				method = strings.ToUpper(value)
+			}
+		}
+	}
+	return method
+}
+
 var protocolHTTP = protocolConfig{
 	name:            "http",
 	secure:          "https",
@@ -15,6 +38,18 @@ var protocolHTTP = protocolConfig{
 	activityVersion: "v0.9.0-rc.1.0.20190509204259-4246269fb68e",
 	port:            9100,
 	contentPath:     "content",
+	serviceInput:    "content",
+	paramsPath:      "pathParams",
+	headersPath:     "headers",
+	serviceHeaders:  "headers",
+	client: &clientConfig{
+		connect:   "newHTTPTransport",
+		imports:   []string{"io/ioutil", "net", "net/http", "net/url", "sync"},
+		transport: httpTransport,
+	},
+	outputs: map[string]string{
+		"query": "queryParams",
+	},
 	triggerSettings: func(s settings) map[string]interface{} {
 		port := "80"
 		if s.secure {
@@ -37,49 +72,74 @@ var protocolHTTP = protocolConfig{
 		return settings
 	},
 	handlerSettings: func(s settings) map[string]interface{} {
+		method := httpMethod(s)
+		if method == "" {
+			method = "POST"
+		}
 		settings := map[string]interface{}{
-			"path": s.topic,
-		}
-		chunks, hasVariables := parseURL(s.topic)
-		if hasVariables {
-			translated := ""
-			for _, chunk := range chunks {
-				if chunk.value != "" {
-					translated += chunk.value
-				} else {
-					translated += ":" + chunk.name
-				}
+			"method": method,
+			"path":   colonPath(s.topic),
+		}
+		return settings
+	},
+	responses: func(s settings) []*api.Response {
+		reply, code, errorCode := false, 200, 500
+		if http := s.binding("http"); http != nil {
+			if value, ok := schemaValue(http["type"]); ok {
+				reply = value == "request"
 			}
-			settings["path"] = translated
 		}
-
-		if s.protocolInfo != nil {
-			if value := s.protocolInfo["flogo-http"]; value != nil {
-				if http, ok := value.(map[string]interface{}); ok {
-					if value := http["method"]; value != nil {
-						if method, ok := value.(string); ok {
-							settings["method"] = method
-						}
-					}
+		if http := s.binding("flogo-http"); http != nil {
+			if value := http["reply"]; value != nil {
+				if value, ok := value.(bool); ok {
+					reply = value
+				}
+			}
+			if value := http["statusCode"]; value != nil {
+				if value, ok := value.(float64); ok {
+					reply, code = true, int(value)
+				}
+			}
+			if value := http["errorStatusCode"]; value != nil {
+				if value, ok := value.(float64); ok {
+					errorCode = int(value)
 				}
 			}
 		}
-		return settings
+		if !reply {
+			return nil
+		}
+		condition := fmt.Sprintf("$.payload.channel == '%s'", s.topic)
+		responses := []*api.Response{
+			{
+				Condition: fmt.Sprintf("%s && $.methodinvoker.outputs.outputData.error != nil", condition),
+				Error:     true,
+				Output: api.Output{
+					Code: errorCode,
+					Data: "=$.methodinvoker.outputs.outputData.error",
+				},
+			},
+			{
+				Condition: condition,
+				Error:     false,
+				Output: api.Output{
+					Code: code,
+					Data: "=$.methodinvoker.outputs.outputData",
+				},
+			},
+		}
+		return responses
 	},
-	serviceSettings: func(s settings) map[string]interface{} {
-		path := s.topic
-		chunks, hasVariables := parseURL(s.topic)
-		if hasVariables {
-			translated := ""
-			for _, chunk := range chunks {
-				if chunk.value != "" {
-					translated += chunk.value
-				} else {
-					translated += ":" + chunk.name
-				}
+	query: func(s settings) map[string]interface{} {
+		if http := s.binding("http"); http != nil {
+			if query, ok := http["query"].(map[string]interface{}); ok {
+				return query
 			}
-			path = translated
 		}
+		return nil
+	},
+	serviceSettings: func(s settings) map[string]interface{} {
+		path := colonPath(s.topic)
 		settings := map[string]interface{}{
 			"uri": fmt.Sprintf("=string.concat(%s, '%s')", s.url[1:], path),
 		}
@@ -87,14 +147,12 @@ var protocolHTTP = protocolConfig{
 		if s.userPassword {
 			// not supported
 		}
+		if method := httpMethod(s); method != "" {
+			settings["method"] = method
+		}
 		if s.protocolInfo != nil {
 			if value := s.protocolInfo["flogo-http"]; value != nil {
 				if http, ok := value.(map[string]interface{}); ok {
-					if value := http["method"]; value != nil {
-						if method, ok := value.(string); ok {
-							settings["method"] = method
-						}
-					}
 					if value := http["headers"]; value != nil {
 						if headers, ok := value.(map[string]string); ok {
 							settings["headers"] = headers
@@ -140,3 +198,116 @@ var protocolHTTP = protocolConfig{
 		return settings
 	},
 }
+
+const httpTransport = `type httpTransport struct {
+	url      string
+	path     string
+	port     string
+	client   *http.Client
+	options  *clientOptions
+	mutex    sync.Mutex
+	server   *http.Server
+	handlers *http.ServeMux
+	secure   bool
+	err      error
+}
+func newHTTPTransport(address string, o *clientOptions) (transport, error) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{}
+	if o.tls != nil {
+		client.Transport = &http.Transport{TLSClientConfig: o.tls}
+	}
+	return &httpTransport{
+		url:     strings.TrimSuffix(address, "/"),
+		path:    strings.TrimSuffix(parsed.Path, "/"),
+		port:    parsed.Port(),
+		client:  client,
+		options: o,
+		secure:  parsed.Scheme == "https",
+	}, nil
+}
+func (h *httpTransport) publish(ctx context.Context, destination string, message []byte, headers map[string]string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url+"/"+strings.TrimPrefix(destination, "/"), bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	if h.options.user != "" {
+		request.SetBasicAuth(h.options.user, h.options.password)
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("message not published: %s", response.Status)
+	}
+	return nil
+}
+func (h *httpTransport) subscribe(ctx context.Context, destination string, handler func(message []byte, headers map[string]string)) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.err != nil {
+		return h.err
+	}
+	if h.server == nil {
+		tlsConfig := h.options.tls
+		if h.secure && (tlsConfig == nil || len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil) {
+			return fmt.Errorf("https subscribe requires a server certificate, set it in the Certificates of WithTLS")
+		}
+		listener, err := net.Listen("tcp", ":"+h.port)
+		if err != nil {
+			return err
+		}
+		if h.secure {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		h.handlers = http.NewServeMux()
+		h.server = &http.Server{Handler: h.handlers}
+		go func() {
+			err := h.server.Serve(listener)
+			if err == http.ErrServerClosed {
+				return
+			}
+			h.mutex.Lock()
+			h.err = err
+			h.mutex.Unlock()
+			if h.options.errors != nil {
+				h.options.errors(err)
+			}
+		}()
+	}
+	h.handlers.HandleFunc(h.path+"/"+strings.TrimPrefix(destination, "/"), func(w http.ResponseWriter, r *http.Request) {
+		if ctx.Err() != nil {
+			http.NotFound(w, r)
+			return
+		}
+		message, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		headers := make(map[string]string, len(r.Header))
+		for key := range r.Header {
+			headers[key] = r.Header.Get(key)
+		}
+		handler(message, headers)
+		w.WriteHeader(http.StatusOK)
+	})
+	return nil
+}
+func (h *httpTransport) close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.server == nil {
+		return nil
+	}
+	return h.server.Close()
+}
+`
@@ -1,7 +1,7 @@
 package transform
 
 import (
-	"strings"
+	"fmt"
 )
 
 var protocolKafka = protocolConfig{
@@ -15,6 +15,14 @@ var protocolKafka = protocolConfig{
 	activityVersion: "v0.9.1-0.20190516180541-534215f1b7ac",
 	port:            9096,
 	contentPath:     "message",
+	serviceInput:    "message",
+	destination:     destinationRules{separator: "."},
+	client: &clientConfig{
+		connect:   "newKafkaTransport",
+		imports:   []string{"github.com/Shopify/sarama"},
+		modules:   map[string]string{"github.com/Shopify/sarama": "v1.29.0"},
+		transport: kafkaTransport,
+	},
 	triggerSettings: func(s settings) map[string]interface{} {
 		settings := map[string]interface{}{
 			"brokerUrls": s.url,
@@ -29,10 +37,8 @@ var protocolKafka = protocolConfig{
 		return settings
 	},
 	handlerSettings: func(s settings) map[string]interface{} {
-		parts := strings.Split(s.topic[1:], "/")
-		topic := strings.Join(parts, ".")
 		settings := map[string]interface{}{
-			"topic": topic,
+			"topic": s.destination,
 		}
 		if s.protocolInfo != nil {
 			if value := s.protocolInfo["flogo-kafka"]; value != nil {
@@ -53,11 +59,9 @@ var protocolKafka = protocolConfig{
 		return settings
 	},
 	serviceSettings: func(s settings) map[string]interface{} {
-		parts := strings.Split(s.topic[1:], "/")
-		topic := strings.Join(parts, ".")
 		settings := map[string]interface{}{
 			"brokerUrls": s.url,
-			"topic":      topic,
+			"topic":      s.destination,
 		}
 		if s.userPassword {
 			settings["user"] = s.user
@@ -68,4 +72,104 @@ var protocolKafka = protocolConfig{
 		}
 		return settings
 	},
+	unsupported: func(s settings) []string {
+		features := []string{}
+		if s.x509 {
+			features = append(features, "the x509 client certificate")
+		}
+		for _, name := range []string{"groupId", "clientId"} {
+			if _, ok := s.binding("kafka")[name]; ok {
+				features = append(features, fmt.Sprintf("the %s binding of channel %s", name, s.topic))
+			}
+		}
+		if _, ok := s.messageBinding("kafka")["key"]; ok {
+			features = append(features, fmt.Sprintf("the message key binding of channel %s", s.topic))
+		}
+		return features
+	},
+}
+
+const kafkaTransport = `type kafkaTransport struct {
+	client   sarama.Client
+	producer sarama.SyncProducer
+}
+func newKafkaTransport(url string, o *clientOptions) (transport, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V0_11_0_0
+	config.Producer.Return.Successes = true
+	if o.user != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User, config.Net.SASL.Password = o.user, o.password
+	}
+	if o.tls != nil {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = o.tls
+	}
+	client, err := sarama.NewClient(strings.Split(url, ","), config)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &kafkaTransport{client: client, producer: producer}, nil
+}
+func (k *kafkaTransport) publish(ctx context.Context, destination string, message []byte, headers map[string]string) error {
+	record := &sarama.ProducerMessage{
+		Topic: destination,
+		Value: sarama.ByteEncoder(message),
+	}
+	for key, value := range headers {
+		record.Headers = append(record.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	_, _, err := k.producer.SendMessage(record)
+	return err
+}
+func (k *kafkaTransport) subscribe(ctx context.Context, destination string, handler func(message []byte, headers map[string]string)) error {
+	consumer, err := sarama.NewConsumerFromClient(k.client)
+	if err != nil {
+		return err
+	}
+	partitions, err := consumer.Partitions(destination)
+	if err != nil {
+		consumer.Close()
+		return err
+	}
+	for _, partition := range partitions {
+		partitionConsumer, err := consumer.ConsumePartition(destination, partition, sarama.OffsetNewest)
+		if err != nil {
+			consumer.Close()
+			return err
+		}
+		go func() {
+			defer partitionConsumer.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case message, ok := <-partitionConsumer.Messages():
+					if !ok {
+						return
+					}
+					headers := make(map[string]string, len(message.Headers))
+					for _, header := range message.Headers {
+						headers[string(header.Key)] = string(header.Value)
+					}
+					handler(message.Value, headers)
+				}
+			}
+		}()
+	}
+	go func() {
+		<-ctx.Done()
+		consumer.Close()
+	}()
+	return nil
+}
+func (k *kafkaTransport) close() error {
+	k.producer.Close()
+	return k.client.Close()
 }
+`
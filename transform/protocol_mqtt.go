@@ -17,7 +17,15 @@ var protocolMQTT = protocolConfig{
 	activityVersion: "v0.0.0-20190711193600-08aa43fa8ef4",
 	port:            9098,
 	contentPath:     "message",
+	serviceInput:    "message",
+	destination:     destinationRules{separator: "/"},
 	paramsPath:      "topicParams",
+	client: &clientConfig{
+		connect:   "newMqttTransport",
+		imports:   []string{"time", "github.com/eclipse/paho.mqtt.golang"},
+		modules:   map[string]string{"github.com/eclipse/paho.mqtt.golang": "v1.3.5"},
+		transport: mqttTransport,
+	},
 	triggerSettings: func(s settings) map[string]interface{} {
 		settings := map[string]interface{}{
 			"id":     fmt.Sprintf("%s%s", s.name, s.serverName),
@@ -76,7 +84,7 @@ var protocolMQTT = protocolConfig{
 		return settings
 	},
 	handlerSettings: func(s settings) map[string]interface{} {
-		topic := s.topic[1:]
+		topic := s.destination
 		settings := map[string]interface{}{
 			"topic": topic,
 		}
@@ -131,7 +139,7 @@ var protocolMQTT = protocolConfig{
 		return settings
 	},
 	serviceSettings: func(s settings) map[string]interface{} {
-		topic := s.topic[1:]
+		topic := s.destination
 		settings := map[string]interface{}{
 			"id":     fmt.Sprintf("%s%s_%s", s.name, s.serverName, s.topic),
 			"broker": s.url,
@@ -201,3 +209,46 @@ var protocolMQTT = protocolConfig{
 		return settings
 	},
 }
+
+const mqttTransport = `type mqttTransport struct {
+	client mqtt.Client
+}
+func newMqttTransport(url string, o *clientOptions) (transport, error) {
+	options := mqtt.NewClientOptions().AddBroker(url)
+	options.SetClientID(fmt.Sprintf("asyncapi-%d", time.Now().UnixNano()))
+	if o.user != "" {
+		options.SetUsername(o.user)
+		options.SetPassword(o.password)
+	}
+	if o.tls != nil {
+		options.SetTLSConfig(o.tls)
+	}
+	client := mqtt.NewClient(options)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+	return &mqttTransport{client: client}, nil
+}
+func (m *mqttTransport) publish(ctx context.Context, destination string, message []byte, headers map[string]string) error {
+	token := m.client.Publish(destination, 0, false, message)
+	token.Wait()
+	return token.Error()
+}
+func (m *mqttTransport) subscribe(ctx context.Context, destination string, handler func(message []byte, headers map[string]string)) error {
+	token := m.client.Subscribe(destination, 0, func(client mqtt.Client, message mqtt.Message) {
+		handler(message.Payload(), nil)
+	})
+	if token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	go func() {
+		<-ctx.Done()
+		m.client.Unsubscribe(destination)
+	}()
+	return nil
+}
+func (m *mqttTransport) close() error {
+	m.client.Disconnect(250)
+	return nil
+}
+`
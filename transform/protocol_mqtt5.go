@@ -0,0 +1,111 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+)
+
+// mqtt5Extensions are the server extensions of the mqtt 5 features the mqtt trigger and activity don't support
+var mqtt5Extensions = []string{"x-session-expiry", "x-topic-alias-maximum", "x-user-properties"}
+
+// mqtt5Bindings are the operation binding fields of the mqtt 5 features the mqtt trigger and activity don't support
+var mqtt5Bindings = []string{"messageExpiryInterval", "noLocal", "replyTopic", "responseTopic", "topicAlias", "userProperties"}
+
+// protocolMQTT5 maps mqtt 5 servers to the mqtt trigger and activity, they connect with mqtt 3.1.1 so only the
+// shared subscriptions and the qos of the mqtt 5 bindings are supported
+var protocolMQTT5 = protocolConfig{
+	name:            "mqtt5",
+	secure:          "secure-mqtt5",
+	trigger:         "github.com/project-flogo/edge-contrib/trigger/mqtt",
+	activity:        "github.com/project-flogo/edge-contrib/activity/mqtt",
+	triggerImport:   "github.com/project-flogo/edge-contrib/trigger/mqtt@%s",
+	activityImport:  "github.com/project-flogo/edge-contrib/activity/mqtt@%s",
+	triggerVersion:  "v0.0.0-20190711193600-08aa43fa8ef4",
+	activityVersion: "v0.0.0-20190711193600-08aa43fa8ef4",
+	port:            9101,
+	contentPath:     "message",
+	serviceInput:    "message",
+	destination:     destinationRules{separator: "/"},
+	paramsPath:      "topicParams",
+	triggerSettings: func(s settings) map[string]interface{} {
+		return protocolMQTT.triggerSettings(s)
+	},
+	handlerSettings: func(s settings) map[string]interface{} {
+		settings := protocolMQTT.handlerSettings(s)
+		sharedGroup := ""
+		if value, ok := s.extensions["x-shared-group"]; ok {
+			if group, ok := value.(string); ok {
+				sharedGroup = group
+			}
+		}
+		for _, name := range []string{"mqtt5", "flogo-mqtt5"} {
+			mqtt5 := s.binding(name)
+			if mqtt5 == nil {
+				continue
+			}
+			if value := mqtt5["sharedGroup"]; value != nil {
+				if group, ok := value.(string); ok {
+					sharedGroup = group
+				}
+			}
+			if value := mqtt5["qos"]; value != nil {
+				if qos, ok := value.(float64); ok {
+					settings["qos"] = int64(qos)
+				}
+			}
+		}
+		if sharedGroup != "" {
+			settings["topic"] = fmt.Sprintf("$share/%s/%s", sharedGroup, settings["topic"])
+		}
+		return settings
+	},
+	serviceSettings: func(s settings) map[string]interface{} {
+		settings := protocolMQTT.serviceSettings(s)
+		for _, name := range []string{"mqtt5", "flogo-mqtt5"} {
+			mqtt5 := s.binding(name)
+			if mqtt5 == nil {
+				continue
+			}
+			if value := mqtt5["qos"]; value != nil {
+				if qos, ok := value.(float64); ok {
+					settings["qos"] = int64(qos)
+				}
+			}
+		}
+		return settings
+	},
+	unsupported: func(s settings) []string {
+		features := []string{}
+		if _, ok := s.serverBinding("mqtt5")["sessionExpiryInterval"]; ok {
+			features = append(features, "the sessionExpiryInterval binding")
+		}
+		for _, name := range mqtt5Extensions {
+			if _, ok := s.extensions[name]; ok {
+				features = append(features, "the "+name+" extension")
+			}
+		}
+		fields := make(map[string]bool)
+		for _, name := range []string{"mqtt5", "flogo-mqtt5"} {
+			for _, field := range mqtt5Bindings {
+				if _, ok := s.binding(name)[field]; ok {
+					fields[field] = true
+				}
+			}
+		}
+		names := make([]string, 0, len(fields))
+		for field := range fields {
+			names = append(names, field)
+		}
+		sort.Strings(names)
+		for _, field := range names {
+			features = append(features, fmt.Sprintf("the %s binding of channel %s", field, s.topic))
+		}
+		if _, ok := s.message["correlationId"]; ok {
+			features = append(features, fmt.Sprintf("the correlation id of channel %s", s.topic))
+		}
+		if s.messageSchema("headers") != nil {
+			features = append(features, fmt.Sprintf("the user properties of the headers of channel %s", s.topic))
+		}
+		return features
+	},
+}
@@ -1,34 +1,204 @@
 package transform
 
 import (
-	"strings"
+	"fmt"
+	"net/url"
 )
 
+// websocketTLS adds the tls settings of a secure websocket connection
+func websocketTLS(s settings, settings map[string]interface{}) {
+	if !s.secure {
+		return
+	}
+	skipVerify := false
+	if value, ok := s.extensions["x-skip-verify"]; ok {
+		if value, ok := value.(bool); ok {
+			skipVerify = value
+		}
+	}
+	settings["allowInsecure"] = skipVerify
+	useSystemCert := true
+	if value, ok := s.extensions["x-use-systemcert"]; ok {
+		if value, ok := value.(bool); !skipVerify && ok {
+			useSystemCert = value
+		}
+	}
+	if !useSystemCert {
+		settings["caCert"] = s.trustStore
+	}
+	if s.x509 {
+		settings["certFile"] = s.certFile
+		settings["keyFile"] = s.keyFile
+	}
+}
+
+// websocketQuery returns the query string of the fixed query parameters of the ws channel binding
+func websocketQuery(s settings) string {
+	values := url.Values{}
+	for name, value := range schemaValues(s.channelBinding("ws")["query"]) {
+		values.Set(name, fmt.Sprint(value))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
 var protocolWebsocket = protocolConfig{
-	name:           "ws",
-	secure:         "wss",
-	trigger:        "github.com/project-flogo/websocket/trigger/wsclient",
-	triggerImport:  "github.com/project-flogo/websocket@%s:/trigger/wsclient",
-	triggerVersion: "v0.0.0-20190708195807-1d89e706e274",
-	port:           9099,
-	contentPath:    "content",
+	name:            "ws",
+	secure:          "wss",
+	trigger:         "github.com/project-flogo/websocket/trigger/wsclient",
+	activity:        "github.com/project-flogo/websocket/activity/wsmessage",
+	triggerImport:   "github.com/project-flogo/websocket@%s:/trigger/wsclient",
+	activityImport:  "github.com/project-flogo/websocket@%s:/activity/wsmessage",
+	triggerVersion:  "v0.0.0-20190708195807-1d89e706e274",
+	activityVersion: "v0.0.0-20190708195807-1d89e706e274",
+	port:            9099,
+	client: &clientConfig{
+		connect:   "newWebsocketTransport",
+		imports:   []string{"net/http", "sync", "github.com/gorilla/websocket"},
+		modules:   map[string]string{"github.com/gorilla/websocket": "v1.4.2"},
+		transport: websocketTransport,
+	},
+	contentPath:         "content",
+	serviceInput:        "message",
+	serverTrigger:       "github.com/project-flogo/websocket/trigger/wsserver",
+	serverTriggerImport: "github.com/project-flogo/websocket@%s:/trigger/wsserver",
+	serverParamsPath:    "pathParams",
+	serverOutputs: map[string]string{
+		"connection": "wsconnection",
+	},
 	triggerSettings: func(s settings) map[string]interface{} {
+		if s.role == "server" {
+			port := "80"
+			if s.secure {
+				port = "443"
+			}
+			if s.urlPort != "" {
+				port = s.urlPort
+			}
+			settings := map[string]interface{}{
+				"port": port,
+			}
+			if s.secure {
+				settings["enableTLS"] = true
+				settings["certFile"] = s.certFile
+				settings["keyFile"] = s.keyFile
+			}
+			return settings
+		}
 		settings := map[string]interface{}{
 			"url": s.url,
 		}
-		if s.userPassword {
-			// not supported
+		websocketTLS(s, settings)
+		return settings
+	},
+	handlerSettings: func(s settings) map[string]interface{} {
+		if s.role == "server" {
+			settings := map[string]interface{}{
+				"method": "GET",
+				"path":   s.path(colonPath(s.topic)),
+			}
+			return settings
 		}
-		if s.secure {
-			// supproted
+		settings := map[string]interface{}{
+			"path": colonPath(s.topic) + websocketQuery(s),
 		}
 		return settings
 	},
-	handlerSettings: func(s settings) map[string]interface{} {
-		parts := strings.Split(s.topic[1:], "/")
-		topic := strings.Join(parts, "_")
-		_ = topic
-		settings := map[string]interface{}{}
+	serviceSettings: func(s settings) map[string]interface{} {
+		if s.role == "server" {
+			// the wsmessage activity dials a uri, it can't send to the clients of the server trigger
+			return nil
+		}
+		settings := map[string]interface{}{
+			"uri": fmt.Sprintf("=string.concat(%s, '%s%s')", s.url[1:], colonPath(s.topic), websocketQuery(s)),
+		}
+		websocketTLS(s, settings)
 		return settings
 	},
+	unsupported: func(s settings) []string {
+		features := []string{}
+		if s.userPassword {
+			features = append(features, "the user and password")
+		}
+		if headers := schemaValues(s.channelBinding("ws")["headers"]); len(headers) > 0 {
+			features = append(features, fmt.Sprintf("the headers of the ws binding of channel %s", s.topic))
+		}
+		return features
+	},
+}
+
+const websocketTransport = `type websocketTransport struct {
+	url         string
+	dialer      *websocket.Dialer
+	header      http.Header
+	mutex       sync.Mutex
+	connections map[string]*websocket.Conn
+}
+func newWebsocketTransport(url string, o *clientOptions) (transport, error) {
+	header := http.Header{}
+	if o.user != "" {
+		request := &http.Request{Header: header}
+		request.SetBasicAuth(o.user, o.password)
+	}
+	return &websocketTransport{
+		url:         strings.TrimSuffix(url, "/"),
+		dialer:      &websocket.Dialer{TLSClientConfig: o.tls},
+		header:      header,
+		connections: make(map[string]*websocket.Conn),
+	}, nil
+}
+func (w *websocketTransport) dial(ctx context.Context, destination string) (*websocket.Conn, error) {
+	connection, _, err := w.dialer.DialContext(ctx, w.url+"/"+strings.TrimPrefix(destination, "/"), w.header)
+	return connection, err
+}
+func (w *websocketTransport) publish(ctx context.Context, destination string, message []byte, headers map[string]string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	connection, ok := w.connections[destination]
+	if !ok {
+		var err error
+		connection, err = w.dial(ctx, destination)
+		if err != nil {
+			return err
+		}
+		w.connections[destination] = connection
+	}
+	if err := connection.WriteMessage(websocket.TextMessage, message); err != nil {
+		connection.Close()
+		delete(w.connections, destination)
+		return err
+	}
+	return nil
+}
+func (w *websocketTransport) subscribe(ctx context.Context, destination string, handler func(message []byte, headers map[string]string)) error {
+	connection, err := w.dial(ctx, destination)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		connection.Close()
+	}()
+	go func() {
+		for {
+			_, message, err := connection.ReadMessage()
+			if err != nil {
+				return
+			}
+			handler(message, nil)
+		}
+	}()
+	return nil
+}
+func (w *websocketTransport) close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for destination, connection := range w.connections {
+		connection.Close()
+		delete(w.connections, destination)
+	}
+	return nil
 }
+`
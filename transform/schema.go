@@ -0,0 +1,90 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// schemaType returns the type of a json schema, the first type which isn't null is used for a list of types
+func schemaType(schema map[string]interface{}) string {
+	switch typ := schema["type"].(type) {
+	case string:
+		return typ
+	case []interface{}:
+		for _, value := range typ {
+			if value, ok := value.(string); ok && value != "null" {
+				return value
+			}
+		}
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	return ""
+}
+
+// schemaGoType returns the go type of a json schema, the go types of objects are written to the support code
+func schemaGoType(support *supportCode, name string, schema interface{}) string {
+	value, ok := schema.(map[string]interface{})
+	if !ok {
+		return "interface{}"
+	}
+	switch schemaType(value) {
+	case "object":
+		properties, ok := value["properties"].(map[string]interface{})
+		if !ok || len(properties) == 0 {
+			return "map[string]interface{}"
+		}
+		return schemaObject(support, name, value, properties)
+	case "array":
+		return "[]" + schemaGoType(support, name+"Item", value["items"])
+	case "string":
+		return "string"
+	case "integer":
+		return "int64"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	}
+	return "interface{}"
+}
+
+// schemaObject writes the go struct of a json schema object
+func schemaObject(support *supportCode, typ string, schema, properties map[string]interface{}) string {
+	if !support.once("type:" + typ) {
+		return typ
+	}
+	required := make(map[string]bool)
+	if values, ok := schema["required"].([]interface{}); ok {
+		for _, value := range values {
+			if value, ok := value.(string); ok {
+				required[value] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	object := bytes.Buffer{}
+	fmt.Fprintf(&object, "type %s struct {\n", typ)
+	for _, name := range names {
+		tag := name
+		if !required[name] {
+			tag += ",omitempty"
+		}
+		field := goName(name)
+		fmt.Fprintf(&object, "\t%s %s `json:%q`\n", field, schemaGoType(support, typ+field, properties[name]), tag)
+	}
+	fmt.Fprintf(&object, "}\n")
+	fmt.Fprintf(&object, "func Decode%s(message interface{}) (*%s, error) {\n", typ, typ)
+	fmt.Fprintf(&object, "\tvalue := &%s{}\n", typ)
+	fmt.Fprintf(&object, "\treturn value, convertMessage(message, value)\n")
+	fmt.Fprintf(&object, "}\n")
+	support.Write(object.Bytes())
+	return typ
+}
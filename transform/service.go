@@ -0,0 +1,200 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/project-flogo/asyncapi/transform/models"
+)
+
+const (
+	// serviceFile is the user owned file implementing the service interface
+	serviceFile = "service.go"
+	// serviceType is the type implementing the service interface in the service file
+	serviceType = "service"
+)
+
+// serviceMethod is a method of the service interface, it handles the messages of an operation on every protocol
+type serviceMethod struct {
+	name        string
+	typ         string
+	description string
+}
+
+// addServiceMethod adds a method to the service interface, the protocols sharing an operation share its method
+func (s *supportCode) addServiceMethod(method serviceMethod) {
+	for _, existing := range s.service {
+		if existing.name != method.name {
+			continue
+		}
+		if existing.typ != method.typ {
+			panic(fmt.Errorf("operation %s has the payloads %s and %s", method.name, existing.typ, method.typ))
+		}
+		return
+	}
+	s.service = append(s.service, method)
+}
+
+// serviceMethods returns the service methods of an operation keyed by the channel, the methods of
+// the messages selected by the dispatcher are keyed by the channel and the message name
+func (s settings) serviceMethods(support *supportCode, operation *models.Operation, messages []map[string]interface{},
+	candidates []messageCandidate) map[string]serviceMethod {
+	if len(messages) == 0 {
+		return nil
+	}
+	name := operationName(operation, s.topic)
+	methods := make(map[string]serviceMethod)
+	if len(candidates) > 1 {
+		for _, candidate := range candidates {
+			methods[s.topic+"#"+candidate.name] = serviceMethod{
+				name:        name + goName(candidate.name),
+				typ:         candidate.typ,
+				description: fmt.Sprintf("the %s messages of channel %s", candidate.name, s.topic),
+			}
+		}
+		return methods
+	}
+	s.message = messages[0]
+	typ := name + "Payload"
+	if message := s.messageField("name"); message != "" {
+		typ = goName(message)
+	}
+	methods[s.topic] = serviceMethod{
+		name:        name,
+		typ:         s.payloadType(support, typ),
+		description: fmt.Sprintf("the messages of channel %s", s.topic),
+	}
+	return methods
+}
+
+// writeServiceOperations writes the operations binding the channels of a protocol to the service methods,
+// and the method of the protocol invoking them
+func writeServiceOperations(support *supportCode, name string, operations map[string]serviceMethod) {
+	support.addImport("context")
+	support.addImport("fmt")
+	support.writeOnce("service", serviceSupport)
+
+	keys := make([]string, 0, len(operations))
+	for key := range operations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(support, "var %sOperations = map[string]serviceOperation{\n", name)
+	for _, key := range keys {
+		method := operations[key]
+		support.addServiceMethod(method)
+		fmt.Fprintf(support, "\t%q: func(ctx context.Context, service Service, values map[string]interface{}) error {\n", key)
+		if method.typ == "" {
+			fmt.Fprintf(support, "\t\treturn service.%s(ctx, values[\"message\"])\n", method.name)
+		} else {
+			fmt.Fprintf(support, "\t\tpayload, err := Decode%s(values[\"message\"])\n", method.typ)
+			fmt.Fprintf(support, "\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+			fmt.Fprintf(support, "\t\treturn service.%s(ctx, *payload)\n", method.name)
+		}
+		fmt.Fprintf(support, "\t},\n")
+	}
+	fmt.Fprintf(support, "}\n")
+	fmt.Fprintf(support, "func %sMethod(inputs interface{}) (map[string]interface{}, error) {\n", name)
+	fmt.Fprintf(support, "\treturn invokeOperation(%sOperations, \"\", inputs)\n", name)
+	fmt.Fprintf(support, "}\n")
+}
+
+// writeService writes the service interface if a protocol invokes it and adds the stubs of its methods to the service file
+func writeService(support *supportCode) {
+	if !support.written["service"] {
+		return
+	}
+	methods := append([]serviceMethod{}, support.service...)
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].name < methods[j].name
+	})
+	payload := func(method serviceMethod) string {
+		if method.typ == "" {
+			return "interface{}"
+		}
+		return method.typ
+	}
+	fmt.Fprintf(support, "// Service handles the messages of the operations of every protocol\n")
+	fmt.Fprintf(support, "type Service interface {\n")
+	for _, method := range methods {
+		fmt.Fprintf(support, "\t// %s handles %s\n", method.name, method.description)
+		fmt.Fprintf(support, "\t%s(ctx context.Context, payload %s) error\n", method.name, payload(method))
+	}
+	fmt.Fprintf(support, "}\n")
+
+	header := fmt.Sprintf(serviceHeader, serviceType)
+	for _, method := range methods {
+		stub := fmt.Sprintf(serviceStub, serviceType, method.name, method.description, payload(method))
+		support.userCode(serviceFile, header, serviceType+"."+method.name, stub)
+	}
+}
+
+const serviceHeader = `package main
+
+import "context"
+
+// %[1]s implements the operations of the spec, this file is created by the generator and then owned by you
+type %[1]s struct{}
+
+func init() {
+	RegisterService(&%[1]s{})
+}
+`
+
+const serviceStub = `// %[2]s handles %[3]s
+func (s *%[1]s) %[2]s(ctx context.Context, payload %[4]s) error {
+	return nil
+}
+`
+
+const serviceSupport = `type serviceOperation func(ctx context.Context, service Service, values map[string]interface{}) error
+type serviceContextKey struct{}
+var registeredService Service
+// RegisterService binds the implementation of the service to the triggers of every protocol
+func RegisterService(service Service) {
+	registeredService = service
+}
+func contextValues(ctx context.Context, name string) map[string]interface{} {
+	values, _ := ctx.Value(serviceContextKey{}).(map[string]interface{})
+	converted := make(map[string]interface{})
+	switch value := values[name].(type) {
+	case map[string]interface{}:
+		return value
+	case map[string]string:
+		for key, value := range value {
+			converted[key] = value
+		}
+	}
+	return converted
+}
+// MessageChannel returns the channel of the message handled by a service method
+func MessageChannel(ctx context.Context) string {
+	values, _ := ctx.Value(serviceContextKey{}).(map[string]interface{})
+	channel, _ := values["channel"].(string)
+	return channel
+}
+// ChannelParams returns the channel parameters of the message handled by a service method
+func ChannelParams(ctx context.Context) map[string]interface{} {
+	return contextValues(ctx, "params")
+}
+// MessageHeaders returns the headers of the message handled by a service method
+func MessageHeaders(ctx context.Context) map[string]interface{} {
+	return contextValues(ctx, "headers")
+}
+func invokeOperation(operations map[string]serviceOperation, message string, inputs interface{}) (map[string]interface{}, error) {
+	values, _ := inputs.(map[string]interface{})
+	channel, _ := values["channel"].(string)
+	if message != "" {
+		channel += "#" + message
+	}
+	operation, ok := operations[channel]
+	if !ok {
+		return nil, fmt.Errorf("no operation handles %s", channel)
+	}
+	if registeredService == nil {
+		return nil, fmt.Errorf("no service is registered for %s", channel)
+	}
+	ctx := context.WithValue(context.Background(), serviceContextKey{}, values)
+	return nil, operation(ctx, registeredService, values)
+}
+`
@@ -0,0 +1,403 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// generatedFile is the file of the generated support code, it is overwritten by each generation
+	generatedFile = "zz_generated.go"
+	// handlersSuffix is the suffix of the user owned files holding the handler methods of a protocol
+	handlersSuffix = "_handlers.go"
+)
+
+// handler is a handler method stub the user implements
+type handler struct {
+	name string
+	code string
+}
+
+// handlerStub is the stub of a handler method with its comment and the body before the return
+const handlerStub = `// %[1]s handles %[2]s
+func %[1]s(inputs interface{}) (map[string]interface{}, error) {
+%[3]s	return nil, nil
+}
+`
+
+// supportCode is the go code generated alongside of the flogo application
+type supportCode struct {
+	bytes.Buffer
+	pkg          string
+	imports      []string
+	written      map[string]bool
+	files        []string
+	code         map[string]*supportCode
+	handlerFiles []string
+	handlers     map[string][]handler
+	headers      map[string]string
+	service      []serviceMethod
+}
+
+// addImport adds an import to the support code
+func (s *supportCode) addImport(path string) {
+	for _, port := range s.imports {
+		if port == path {
+			return
+		}
+	}
+	s.imports = append(s.imports, path)
+}
+
+// once returns true the first time it is called with a name
+func (s *supportCode) once(name string) bool {
+	if s.written == nil {
+		s.written = make(map[string]bool)
+	}
+	if s.written[name] {
+		return false
+	}
+	s.written[name] = true
+	return true
+}
+
+// writeOnce writes code shared by the protocols only once
+func (s *supportCode) writeOnce(name, code string) {
+	if s.once(name) {
+		s.WriteString(code)
+	}
+}
+
+// file returns a go file generated next to the support code
+func (s *supportCode) file(name string) *supportCode {
+	if s.code == nil {
+		s.code = make(map[string]*supportCode)
+	}
+	if code, ok := s.code[name]; ok {
+		return code
+	}
+	code := &supportCode{pkg: s.pkg}
+	s.files = append(s.files, name)
+	s.code[name] = code
+	return code
+}
+
+// handler adds the stub of a handler method to the handlers file of the protocol
+func (s *supportCode) handler(protocol, name, code string) {
+	file := protocol + handlersSuffix
+	s.userCode(file, fmt.Sprintf("package main\n\n// %s handlers, this file is created by the generator and then owned by you\n", protocol), name, code)
+}
+
+// userCode adds a stub to a user owned file, the header starts the file when it is created
+func (s *supportCode) userCode(file, header, name, code string) {
+	if s.handlers == nil {
+		s.handlers = make(map[string][]handler)
+		s.headers = make(map[string]string)
+	}
+	if _, ok := s.handlers[file]; !ok {
+		s.handlerFiles = append(s.handlerFiles, file)
+		s.headers[file] = header
+	}
+	s.handlers[file] = append(s.handlers[file], handler{name: name, code: code})
+}
+
+// handlerStubs returns the stubs of the handlers file which aren't declared yet
+func (s *supportCode) handlerStubs(file string, declared map[string]string) []byte {
+	code := bytes.Buffer{}
+	for _, handler := range s.handlers[file] {
+		if _, ok := declared[handler.name]; ok {
+			continue
+		}
+		fmt.Fprintf(&code, "\n%s", handler.code)
+	}
+	return code.Bytes()
+}
+
+// declaredFuncs returns the functions declared by the user owned go files of the directory with the file declaring them,
+// methods are prefixed with the name of their receiver type
+func (s *supportCode) declaredFuncs(directory string) map[string]string {
+	declared := make(map[string]string)
+	files, err := filepath.Glob(filepath.Join(directory, "*.go"))
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		if name := filepath.Base(file); name == generatedFile || s.code[name] != nil {
+			continue
+		}
+		parsed, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+		if err != nil {
+			panic(err)
+		}
+		for _, decl := range parsed.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			name := fn.Name.Name
+			if fn.Recv != nil && len(fn.Recv.List) == 1 {
+				typ := fn.Recv.List[0].Type
+				if star, ok := typ.(*ast.StarExpr); ok {
+					typ = star.X
+				}
+				if ident, ok := typ.(*ast.Ident); ok {
+					name = ident.Name + "." + name
+				}
+			}
+			declared[name] = filepath.Base(file)
+		}
+	}
+	return declared
+}
+
+// write writes the support code and the files next to it to the output directory,
+// the handlers files are created if they are missing and only get the stubs of new handlers
+func (s *supportCode) write(output string) {
+	err := ioutil.WriteFile(filepath.Join(output, generatedFile), s.Bytes(), 0644)
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range s.files {
+		err := ioutil.WriteFile(filepath.Join(output, name), s.code[name].Bytes(), 0644)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(output, "support.go")); err == nil {
+		fmt.Fprintf(os.Stderr, "warning: support.go of a previous generation declares the generated code, move its methods to the handlers files and remove it\n")
+	}
+
+	declared := s.declaredFuncs(output)
+	handlers := make(map[string]bool)
+	for _, file := range s.handlerFiles {
+		for _, handler := range s.handlers[file] {
+			handlers[handler.name] = true
+		}
+		path := filepath.Join(output, file)
+		stubs := s.handlerStubs(file, declared)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			err := ioutil.WriteFile(path, append([]byte(s.headers[file]), stubs...), 0644)
+			if err != nil {
+				panic(err)
+			}
+			continue
+		}
+		if len(stubs) == 0 {
+			continue
+		}
+		handlersFile, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			panic(err)
+		}
+		_, err = handlersFile.Write(stubs)
+		if err != nil {
+			panic(err)
+		}
+		err = handlersFile.Close()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	names := make([]string, 0, len(declared))
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := declared[name]
+		if handlers[name] {
+			continue
+		}
+		handler := strings.HasSuffix(file, handlersSuffix) && (strings.HasSuffix(name, "Method") || strings.HasSuffix(name, "DeadLetter"))
+		operation := file == serviceFile && strings.HasPrefix(name, serviceType+".")
+		if handler || operation {
+			fmt.Fprintf(os.Stderr, "warning: handler %s in %s is no longer used by the spec and can be removed\n", name, file)
+		}
+	}
+}
+
+// Bytes returns the support code with its imports
+func (s *supportCode) Bytes() []byte {
+	code := bytes.Buffer{}
+	fmt.Fprintf(&code, "// Code generated by asyncapi. DO NOT EDIT.\n\n")
+	pkg := s.pkg
+	if pkg == "" {
+		pkg = "main"
+	}
+	fmt.Fprintf(&code, "package %s\n", pkg)
+	for _, port := range s.imports {
+		fmt.Fprintf(&code, "import %q\n", port)
+	}
+	code.Write(s.Buffer.Bytes())
+	return code.Bytes()
+}
+
+// queryParameter is a query parameter of an operation, the enum of an array applies to its items
+type queryParameter struct {
+	typ      string
+	items    string
+	required bool
+	enum     []string
+}
+
+// queryParameters returns the query parameters of an object schema
+func queryParameters(schema map[string]interface{}) map[string]queryParameter {
+	parameters := make(map[string]queryParameter)
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		for name, value := range properties {
+			parameter := queryParameter{
+				typ: "string",
+			}
+			if property, ok := value.(map[string]interface{}); ok {
+				if typ, ok := property["type"].(string); ok {
+					parameter.typ = typ
+				}
+				if parameter.typ == "array" {
+					parameter.items = "string"
+					property, _ = property["items"].(map[string]interface{})
+					if typ, ok := property["type"].(string); ok {
+						parameter.items = typ
+					}
+				}
+				if enum, ok := property["enum"].([]interface{}); ok {
+					for _, value := range enum {
+						parameter.enum = append(parameter.enum, fmt.Sprint(value))
+					}
+				}
+			}
+			parameters[name] = parameter
+		}
+	}
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, value := range required {
+			if name, ok := value.(string); ok {
+				parameter, ok := parameters[name]
+				if !ok {
+					parameter.typ = "string"
+				}
+				parameter.required = true
+				parameters[name] = parameter
+			}
+		}
+	}
+	return parameters
+}
+
+// writeQueryValidator writes a method validating the query parameters of each channel
+func writeQueryValidator(support *supportCode, name string, queries map[string]map[string]queryParameter) {
+	support.addImport("encoding/json")
+	support.addImport("fmt")
+	support.addImport("strings")
+
+	channels := make([]string, 0, len(queries))
+	for channel := range queries {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	fmt.Fprintf(support, "type %sQueryParameter struct {\n", name)
+	fmt.Fprintf(support, "\ttyp      string\n")
+	fmt.Fprintf(support, "\titems    string\n")
+	fmt.Fprintf(support, "\trequired bool\n")
+	fmt.Fprintf(support, "\tenum     []string\n")
+	fmt.Fprintf(support, "}\n")
+	fmt.Fprintf(support, "var %sQueries = map[string]map[string]%sQueryParameter{\n", name, name)
+	for _, channel := range channels {
+		fmt.Fprintf(support, "\t%q: {\n", channel)
+		parameters := queries[channel]
+		names := make([]string, 0, len(parameters))
+		for parameter := range parameters {
+			names = append(names, parameter)
+		}
+		sort.Strings(names)
+		for _, parameter := range names {
+			value := parameters[parameter]
+			fmt.Fprintf(support, "\t\t%q: {typ: %q, items: %q, required: %t, enum: %#v},\n", parameter, value.typ, value.items, value.required, value.enum)
+		}
+		fmt.Fprintf(support, "\t},\n")
+	}
+	fmt.Fprintf(support, "}\n")
+	fmt.Fprintf(support, queryValidator, name)
+	fmt.Fprintf(support, "func init() {\n")
+	fmt.Fprintf(support, "\tmethodinvoker.RegisterMethods(\"%sValidate\", %sValidate)\n", name, name)
+	fmt.Fprintf(support, "}\n")
+}
+
+const queryValidator = `func %[1]sValidate(inputs interface{}) (map[string]interface{}, error) {
+	values, _ := inputs.(map[string]interface{})
+	channel, _ := values["channel"].(string)
+	invalid := func(format string, a ...interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"valid": false, "error": fmt.Sprintf(format, a...)}, nil
+	}
+	query := make(map[string]string)
+	switch params := values["query"].(type) {
+	case map[string]string:
+		query = params
+	case map[string]interface{}:
+		for key, value := range params {
+			query[key] = fmt.Sprint(value)
+		}
+	}
+	valid := func(value, typ string) bool {
+		var parsed interface{} = value
+		switch typ {
+		case "integer", "number", "boolean":
+			if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+				return false
+			}
+		}
+		switch parsed := parsed.(type) {
+		case float64:
+			return typ == "number" || (typ == "integer" && parsed == float64(int64(parsed)))
+		case bool:
+			return typ == "boolean"
+		}
+		return typ == "string"
+	}
+	for name, parameter := range %[1]sQueries[channel] {
+		value, ok := query[name]
+		if !ok {
+			if parameter.required {
+				return invalid("missing query parameter %%s", name)
+			}
+			continue
+		}
+		items, typ := []string{value}, parameter.typ
+		switch typ {
+		case "object":
+			// the properties of an object are not validated
+			continue
+		case "array":
+			// the items of an array are separated by commas
+			items, typ = strings.Split(value, ","), parameter.items
+		}
+		for _, item := range items {
+			if !valid(item, typ) {
+				return invalid("query parameter %%s is not a %%s", name, parameter.typ)
+			}
+			if len(parameter.enum) > 0 {
+				found := false
+				for _, allowed := range parameter.enum {
+					if allowed == item {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return invalid("query parameter %%s has an invalid value %%s", name, item)
+				}
+			}
+		}
+	}
+	return map[string]interface{}{"valid": true}, nil
+}
+`
@@ -1,10 +1,12 @@
 package transform
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -22,26 +24,69 @@ import (
 const (
 	// MicrogatewayVersion is the version of the microgateway to use
 	MicrogatewayVersion = "v0.0.0-20190708190753-c54f135979ec"
+	// loopbackPortOffset offsets the first port the client side of a loopback app tries to listen on
+	loopbackPortOffset = 100
 )
 
-// Transform converts an asyn api to a new representation
+// Transform converts an asyn api to a new representation, TransformConfig sets the other options
 func Transform(input, output, conversionType, role string) {
-	switch role {
-	case "server":
-	case "client":
-	default:
-		panic("invalid role")
-	}
-	switch conversionType {
+	TransformConfig(Config{
+		Input:  input,
+		Type:   conversionType,
+		Role:   role,
+		Output: output,
+	})
+}
+
+// TransformConfig converts the async api of a config to a new representation
+func TransformConfig(config Config) {
+	config = config.defaults()
+	switch config.Type {
 	case "flogoapiapp":
-		ToAPI(input, output, role)
+		toAPI(config)
 	case "flogodescriptor":
-		ToJSON(input, output, role)
+		toJSON(config)
+	case "flogomodule":
+		toModule(config)
+	case "goclient":
+		toGoClient(config)
 	default:
 		panic("invalid type")
 	}
 }
 
+// options configure a conversion
+type options struct {
+	role        string
+	destination destinationRules
+	deadLetter  deadLetterRules
+	directory   string
+	service     bool
+	versions    versionLock
+	specs       map[string]string
+	ports       listenPorts
+	config      Config
+}
+
+// listenPorts are the ports the triggers of the app listen on
+type listenPorts map[int]string
+
+// listen reserves the port of a trigger, the client side of a loopback app gets the first free port
+// from the port plus loopbackPortOffset
+func (l listenPorts) listen(port int, id string, loopback bool) int {
+	if loopback {
+		port += loopbackPortOffset
+		for l[port] != "" && l[port] != id {
+			port++
+		}
+	}
+	if owner := l[port]; owner != "" && owner != id {
+		panic(fmt.Errorf("trigger %s: port %d is already used by trigger %s", id, port, owner))
+	}
+	l[port] = id
+	return port
+}
+
 type protocolConfig struct {
 	name, secure                    string
 	trigger, activity               string
@@ -49,10 +94,24 @@ type protocolConfig struct {
 	triggerVersion, activityVersion string
 	port                            int
 	contentPath                     string
+	serviceInput                    string
 	paramsPath                      string
+	headersPath                     string
+	serviceHeaders                  string
+	outputs                         map[string]string
+	serverTrigger                   string
+	serverTriggerImport             string
+	serverOutputs                   map[string]string
+	serverParamsPath                string
+	responses                       func(s settings) []*api.Response
+	query                           func(s settings) map[string]interface{}
 	triggerSettings                 func(s settings) map[string]interface{}
 	handlerSettings                 func(s settings) map[string]interface{}
 	serviceSettings                 func(s settings) map[string]interface{}
+	unsupported                     func(s settings) []string
+	destination                     destinationRules
+	client                          *clientConfig
+	loopback                        bool
 }
 
 var configs = [...]protocolConfig{
@@ -60,34 +119,48 @@ var configs = [...]protocolConfig{
 	protocolHTTP,
 	protocolKafka,
 	protocolMQTT,
+	protocolMQTT5,
 	protocolWebsocket,
 }
 
 type settings struct {
 	protocolConfig
-	secure       bool
-	userPassword bool
-	serverName   string
-	url          string
-	urlPort      string
-	user         string
-	password     string
-	trustStore   string
-	certFile     string
-	keyFile      string
-	extensions   map[string]interface{}
-	parameters   map[string]*models.Parameter
-	topic        string
-	protocolInfo map[string]interface{}
+	role               string
+	directory          string
+	secure             bool
+	userPassword       bool
+	x509               bool
+	serverName         string
+	url                string
+	urlPort            string
+	urlPath            []chunk
+	user               string
+	password           string
+	trustStore         string
+	certFile           string
+	keyFile            string
+	extensions         map[string]interface{}
+	parameters         map[string]*models.Parameter
+	topic              string
+	destination        string
+	defaultContentType string
+	protocolInfo       map[string]interface{}
+	message            map[string]interface{}
+	serverInfo         map[string]interface{}
+	channelInfo        map[string]interface{}
 }
 
 func userPassword(server *models.Server, schemes map[string]interface{}) bool {
+	return securityType(server, schemes, "userPassword")
+}
+
+func securityType(server *models.Server, schemes map[string]interface{}, securityType string) bool {
 	for _, requirement := range server.Security {
 		for scheme := range requirement.AdditionalProperties {
 			if entry := schemes[scheme]; entry != nil {
 				if definition, ok := entry.(map[string]interface{}); ok {
 					if value := definition["type"]; value != nil {
-						if typ, ok := value.(string); ok && typ == "userPassword" {
+						if typ, ok := value.(string); ok && typ == securityType {
 							return true
 						}
 					}
@@ -98,79 +171,194 @@ func userPassword(server *models.Server, schemes map[string]interface{}) bool {
 	return false
 }
 
-type chunk struct {
-	name  string
-	value string
+// variableProperty returns the property holding the value of a server variable
+func variableProperty(protocol, serverName, name string) string {
+	return fmt.Sprintf("$property[%s%s_%s]", protocol, serverName, name)
 }
 
-func parseURL(url string) ([]chunk, bool) {
-	var (
-		chunks      []chunk
-		parsed      []rune
-		hasVariable bool
-	)
-	for _, s := range url {
-		switch s {
-		case '{':
-			if len(parsed) > 0 {
-				chunks, parsed = append(chunks, chunk{value: string(parsed)}), parsed[:0]
-			}
-		case '}':
-			if len(parsed) > 0 {
-				chunks, parsed = append(chunks, chunk{name: string(parsed)}), parsed[:0]
-				hasVariable = true
-			}
-		default:
-			parsed = append(parsed, s)
+// path returns the server url path followed by suffix as a setting value
+func (s settings) path(suffix string) string {
+	if length := len(s.urlPath); length > 0 && strings.HasSuffix(s.urlPath[length-1].value, "/") {
+		suffix = strings.TrimPrefix(suffix, "/")
+	}
+	chunks := append(append([]chunk{}, s.urlPath...), chunk{value: suffix})
+	if !hasVariable(chunks) {
+		path := ""
+		for _, chunk := range chunks {
+			path += chunk.value
 		}
+		return path
+	}
+	return "=" + concat(chunks, func(name string) string {
+		return variableProperty(s.name, s.serverName, name)
+	})
+}
+
+// warnUnsupported warns once about each feature of the operation the modules of the protocol don't support
+func (s settings) warnUnsupported(warned map[string]bool) {
+	if s.unsupported == nil {
+		return
 	}
-	if len(parsed) > 0 {
-		chunks, parsed = append(chunks, chunk{value: string(parsed)}), parsed[:0]
+	for _, feature := range s.unsupported(s) {
+		s.warn(warned, feature)
 	}
-	return chunks, hasVariable
 }
 
-func getPort(url string) ([]chunk, bool) {
-	var (
-		chunks      []chunk
-		parsed      []rune
-		hasVariable bool
-	)
-	foundPort := false
-	for _, s := range url {
-		if foundPort {
-			if s == '/' {
-				foundPort = false
-			} else {
-				switch s {
-				case '{':
-					if len(parsed) > 0 {
-						chunks, parsed = append(chunks, chunk{value: string(parsed)}), parsed[:0]
+// warn warns once about a feature of the spec the modules of the protocol don't support
+func (s settings) warn(warned map[string]bool, feature string) {
+	if !warned[feature] {
+		warned[feature] = true
+		fmt.Fprintf(os.Stderr, "warning: server %s: %s isn't supported by the %s trigger and activity, it is ignored\n", s.serverName, feature, s.name)
+	}
+}
+
+// binding returns the named operation binding
+func (s settings) binding(name string) map[string]interface{} {
+	if value := s.protocolInfo[name]; value != nil {
+		if binding, ok := value.(map[string]interface{}); ok {
+			return binding
+		}
+	}
+	return nil
+}
+
+// messageBinding returns the named binding of the message or of its traits
+func (s settings) messageBinding(name string) map[string]interface{} {
+	if s.message == nil {
+		return nil
+	}
+	binding := make(map[string]interface{})
+	merge := func(value interface{}) {
+		if value, ok := value.(map[string]interface{}); ok {
+			if value, ok := value["bindings"]; ok {
+				if bindings, ok := value.(map[string]interface{}); ok {
+					if value, ok := bindings[name].(map[string]interface{}); ok {
+						for key, value := range value {
+							binding[key] = value
+						}
 					}
-				case '}':
-					if len(parsed) > 0 {
-						chunks, parsed = append(chunks, chunk{name: string(parsed)}), parsed[:0]
+				}
+			}
+		}
+	}
+	if value, ok := s.message["traits"].([]interface{}); ok {
+		for _, trait := range value {
+			merge(trait)
+		}
+	}
+	merge(s.message)
+	if len(binding) == 0 {
+		return nil
+	}
+	return binding
+}
+
+// bindingsObject converts a bindings object into a map of bindings
+func bindingsObject(object *models.BindingsObject) map[string]interface{} {
+	bindings := make(map[string]interface{})
+	if object == nil {
+		return bindings
+	}
+	raw, err := json.Marshal(object)
+	if err != nil {
+		panic(err)
+	}
+	values := make(map[string]interface{})
+	err = json.Unmarshal(raw, &values)
+	if err != nil {
+		panic(err)
+	}
+	for key, value := range values {
+		if value != nil {
+			bindings[key] = value
+		}
+	}
+	return bindings
+}
+
+// serverBinding returns the named server binding
+func (s settings) serverBinding(name string) map[string]interface{} {
+	if value := s.serverInfo[name]; value != nil {
+		if binding, ok := value.(map[string]interface{}); ok {
+			return binding
+		}
+	}
+	return nil
+}
+
+// channelBinding returns the named channel binding
+func (s settings) channelBinding(name string) map[string]interface{} {
+	if value := s.channelInfo[name]; value != nil {
+		if binding, ok := value.(map[string]interface{}); ok {
+			return binding
+		}
+	}
+	return nil
+}
+
+// schemaValues returns the fixed values of the properties of an object schema
+func schemaValues(schema interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	if schema, ok := schema.(map[string]interface{}); ok {
+		if properties, ok := schema["properties"].(map[string]interface{}); ok {
+			for name, property := range properties {
+				if value, ok := schemaValue(property); ok {
+					values[name] = value
+				}
+			}
+		}
+	}
+	return values
+}
+
+// operationBindings collects the bindings of an operation and of its traits
+func operationBindings(operation *models.Operation) map[string]interface{} {
+	protocolInfo := make(map[string]interface{})
+	for _, trait := range operation.Traits {
+		if value, ok := trait.(map[string]interface{}); ok {
+			if value, ok := value["bindings"]; ok {
+				if bindings, ok := value.(map[string]interface{}); ok {
+					for key, value := range bindings {
+						protocolInfo[key] = value
 					}
-					hasVariable = true
-				default:
-					parsed = append(parsed, s)
 				}
 			}
-		} else if s == ':' {
-			foundPort = true
 		}
 	}
-	if len(parsed) > 0 {
-		chunks, parsed = append(chunks, chunk{value: string(parsed)}), parsed[:0]
+	for key, value := range bindingsObject(operation.Bindings) {
+		protocolInfo[key] = value
 	}
+	return protocolInfo
+}
 
-	return chunks, hasVariable
+// schemaValue returns the fixed value of a binding that is either a plain value or a schema
+func schemaValue(value interface{}) (interface{}, bool) {
+	if value == nil {
+		return nil, false
+	}
+	schema, ok := value.(map[string]interface{})
+	if !ok {
+		return value, true
+	}
+	if value, ok := schema["const"]; ok {
+		return value, true
+	}
+	if value, ok := schema["enum"].([]interface{}); ok && len(value) == 1 {
+		return value[0], true
+	}
+	if value, ok := schema["default"]; ok {
+		return value, true
+	}
+	return nil, false
 }
 
-func (p protocolConfig) protocol(support *bytes.Buffer, model *models.AsyncAPI200Schema, schemes map[string]interface{}, flogo *app.Config, role string) {
+func (p protocolConfig) protocol(support *supportCode, model *models.AsyncAPI200Schema, schemes map[string]interface{}, flogo *app.Config, o options) {
 	addImport := func(path, version string) {
+		version = o.versions.version(strings.SplitN(path, "@", 2)[0], version)
 		if version != "" {
 			path = fmt.Sprintf(path, version)
+		} else {
+			path = strings.Replace(strings.Replace(path, "@%s:", "", 1), "@%s", "", 1)
 		}
 		for _, port := range flogo.Imports {
 			if strings.Contains(port, path) {
@@ -180,9 +368,42 @@ func (p protocolConfig) protocol(support *bytes.Buffer, model *models.AsyncAPI20
 		flogo.Imports = append(flogo.Imports, path)
 	}
 
-	services, triggers := make([]*api.Service, 0, 8), make([]*trigger.Config, 0, 8)
-	for serverName, server := range model.Servers {
-		if server.Protocol == p.name || server.Protocol == p.secure {
+	publishers, triggers := make([]publisher, 0, 8), make([]*trigger.Config, 0, 8)
+	responses, queries := make([]*api.Response, 0, 8), make(map[string]map[string]queryParameter)
+	params := make(map[string][]channelParameter)
+	decoders, encoders := make(map[string]string), make(map[string]string)
+	dispatch := make(map[string][]messageCandidate)
+	receiveHeaders, publishHeaders := make(map[string][]messageHeader), make(map[string][]messageHeader)
+	deadLetters, deadLetterServices := make(map[string]deadLetter), make(map[string]*api.Service)
+	operations := make(map[string]serviceMethod)
+	warned := make(map[string]bool)
+	// the client side of the servers with the both role has its own triggers, gateways and support code
+	protocolName := p.name
+	if p.loopback {
+		p.name += "Client"
+	}
+	// the servers are sorted so the client sides of a loopback app get the same ports on every run
+	serverNames := make([]string, 0, len(model.Servers))
+	for serverName := range model.Servers {
+		serverNames = append(serverNames, serverName)
+	}
+	sort.Strings(serverNames)
+	for _, serverName := range serverNames {
+		server := model.Servers[serverName]
+		if protocol := server.Protocol; protocol == protocolName || protocol == p.secure {
+			p, role := p, o.serverRole(serverName, server)
+			switch {
+			case role == "both" && p.loopback:
+				role = "client"
+			case role == "both":
+				role = "server"
+			case p.loopback:
+				continue
+			}
+			if role == "server" && p.serverTrigger != "" {
+				p.trigger, p.triggerImport = p.serverTrigger, p.serverTriggerImport
+				p.outputs, p.paramsPath = p.serverOutputs, p.serverParamsPath
+			}
 			if server.Variables != nil {
 				for name, variable := range server.Variables.AdditionalProperties {
 					defaultValue, foundDefault := variable.Default, false
@@ -203,26 +424,22 @@ func (p protocolConfig) protocol(support *bytes.Buffer, model *models.AsyncAPI20
 				}
 			}
 
-			brokerUrls := ""
-			if chunks, hasVariable := parseURL(server.Url); hasVariable {
-				if len(chunks) > 1 {
-					comma := ""
-					brokerUrls += "=string.concat("
-					for _, chunk := range chunks {
-						if chunk.name != "" {
-							brokerUrls += fmt.Sprintf("%s$property[%s%s_%s]", comma, p.name, serverName, chunk.name)
-							comma = ", "
-							continue
-						}
-						brokerUrls += fmt.Sprintf("%s'%s'", comma, chunk.value)
-						comma = ", "
-					}
-					brokerUrls += ")"
-				} else {
-					chunk := chunks[0]
-					brokerUrls += "="
-					brokerUrls += fmt.Sprintf("$property[%s%s_%s]", p.name, serverName, chunk.name)
+			url, err := parseServerURL(server.Url)
+			if err != nil {
+				panic(fmt.Errorf("server %s: %v", serverName, err))
+			}
+			for _, name := range url.variables() {
+				if server.Variables == nil || server.Variables.AdditionalProperties[name] == nil {
+					panic(fmt.Errorf("server %s: url variable %s is not defined", serverName, name))
 				}
+			}
+			property := func(name string) string {
+				return variableProperty(p.name, serverName, name)
+			}
+
+			brokerUrls := ""
+			if hasVariable(url.chunks) {
+				brokerUrls = "=" + concat(url.chunks, property)
 			} else {
 				brokerUrls = fmt.Sprintf("%s%sURL", p.name, serverName)
 				attribute := data.NewAttribute(brokerUrls, data.TypeString, server.Url)
@@ -230,20 +447,29 @@ func (p protocolConfig) protocol(support *bytes.Buffer, model *models.AsyncAPI20
 				flogo.Properties = append(flogo.Properties, attribute)
 			}
 
+			credentials := o.credentials(protocolName, serverName)
 			s := settings{
-				protocolConfig: p,
-				secure:         server.Protocol == p.secure,
-				userPassword:   userPassword(server, schemes),
-				serverName:     serverName,
-				url:            brokerUrls,
-				user:           "=$env[USER]",
-				password:       "=$env[PASSWORD]",
-				trustStore:     "=$env[TRUST_STORE]",
-				certFile:       "=$env[CERT_FILE]",
-				keyFile:        "=$env[KEY_FILE]",
-				extensions:     server.AdditionalProperties,
+				protocolConfig:     p,
+				role:               role,
+				directory:          o.directory,
+				secure:             server.Protocol == p.secure,
+				userPassword:       userPassword(server, schemes),
+				x509:               securityType(server, schemes, "X509"),
+				serverName:         serverName,
+				url:                brokerUrls,
+				user:               fmt.Sprintf("=$env[%s]", credentials.User),
+				password:           fmt.Sprintf("=$env[%s]", credentials.Password),
+				trustStore:         fmt.Sprintf("=$env[%s]", credentials.TrustStore),
+				certFile:           fmt.Sprintf("=$env[%s]", credentials.CertFile),
+				keyFile:            fmt.Sprintf("=$env[%s]", credentials.KeyFile),
+				extensions:         server.AdditionalProperties,
+				defaultContentType: model.DefaultContentType,
+				serverInfo:         bindingsObject(server.Bindings),
 			}
 
+			s.urlPath = url.path
+
+			// the versions of the version lock override the versions of the extensions
 			triggerVersion, activityVersion := s.triggerVersion, s.activityVersion
 			if value, ok := s.extensions["x-trigger-version"]; ok {
 				if version, ok := value.(string); ok {
@@ -258,40 +484,21 @@ func (p protocolConfig) protocol(support *bytes.Buffer, model *models.AsyncAPI20
 			addImport(p.triggerImport, triggerVersion)
 			addImport(p.activityImport, activityVersion)
 
-			if chunks, hasVariable := getPort(server.Url); len(chunks) > 0 {
-				if hasVariable {
-					if len(chunks) > 1 {
-						comma := ""
-						s.urlPort += "=string.integer(string.concat("
-						for _, chunk := range chunks {
-							if chunk.name != "" {
-								s.urlPort += fmt.Sprintf("%s$property[%s%s_%s]", comma, p.name, serverName, chunk.name)
-								comma = ", "
-								continue
-							}
-							s.urlPort += fmt.Sprintf("%s'%s'", comma, chunk.value)
-							comma = ", "
-						}
-						s.urlPort += "))"
-					} else {
-						chunk := chunks[0]
-						s.urlPort += "=string.integer("
-						s.urlPort += fmt.Sprintf("$property[%s%s_%s]", p.name, serverName, chunk.name)
-						s.urlPort += ")"
-					}
+			urlPort, portProperty := 0, ""
+			if port := url.port(); len(port) > 0 {
+				if hasVariable(port) {
+					s.urlPort = "=string.integer(" + concat(port, property) + ")"
+					// the collisions are checked with the default values of the variables
+					urlPort, _ = strconv.Atoi(expand(port, func(name string) string {
+						return server.Variables.AdditionalProperties[name].Default
+					}))
 				} else {
-					port := ""
-					for _, p := range chunks {
-						port += p.value
-					}
-					value, err := strconv.Atoi(port)
+					value, err := strconv.Atoi(port[0].value)
 					if err != nil {
 						panic(err)
 					}
-					s.urlPort = fmt.Sprintf("%s%sPort", p.name, serverName)
-					attribute := data.NewAttribute(s.urlPort, data.TypeInt, value)
-					s.urlPort = fmt.Sprintf("=$property[%s]", s.urlPort)
-					flogo.Properties = append(flogo.Properties, attribute)
+					urlPort, portProperty = value, fmt.Sprintf("%s%sPort", p.name, serverName)
+					s.urlPort = fmt.Sprintf("=$property[%s]", portProperty)
 				}
 			}
 
@@ -301,42 +508,97 @@ func (p protocolConfig) protocol(support *bytes.Buffer, model *models.AsyncAPI20
 				Settings: p.triggerSettings(s),
 			}
 
+			// the triggers with a port setting listen on it
+			switch port := trig.Settings["port"]; {
+			case port == nil:
+			case port == s.urlPort:
+				if urlPort == 0 {
+					break
+				}
+				listen := o.ports.listen(urlPort, trig.Id, p.loopback)
+				if portProperty == "" && listen != urlPort {
+					trig.Settings["port"] = fmt.Sprintf("%s + %d", s.urlPort, listen-urlPort)
+				}
+				urlPort = listen
+			default:
+				if value, err := strconv.Atoi(fmt.Sprint(port)); err == nil {
+					trig.Settings["port"] = strconv.Itoa(o.ports.listen(value, trig.Id, p.loopback))
+				}
+			}
+			if portProperty != "" {
+				flogo.Properties = append(flogo.Properties, data.NewAttribute(portProperty, data.TypeInt, urlPort))
+			}
+
 			if model.Channels != nil {
 				for name, channel := range model.Channels.AdditionalProperties {
 					s.parameters = channel.Parameters
+					s.channelInfo = bindingsObject(channel.Bindings)
 					if strings.HasPrefix(name, "/") {
 						s.topic = name
 					} else {
 						s.topic = "/" + name
 					}
+					destination, channelRules := destinationExtension(channel.AdditionalProperties)
+					if destination == "" {
+						destination = p.destination.merge(o.destination).merge(channelRules).destination(s.topic, protocolName, serverName)
+					}
+					s.destination = destination
 					subscribe, publish := channel.Subscribe, channel.Publish
 					if role == "client" {
 						subscribe, publish = publish, subscribe
 					}
 					if subscribe != nil {
-						if len(subscribe.Traits) > 0 {
-							s.protocolInfo = make(map[string]interface{})
-							for _, trait := range subscribe.Traits {
-								if value, ok := trait.(map[string]interface{}); ok {
-									if value, ok := value["bindings"]; ok {
-										if bindings, ok := value.(map[string]interface{}); ok {
-											for key, value := range bindings {
-												s.protocolInfo[key] = value
-											}
-										}
-									}
-								}
+						s.protocolInfo = operationBindings(subscribe)
+						s.message = nil
+						messages := operationMessages(subscribe)
+						if len(messages) > 0 {
+							s.message = messages[0]
+						}
+						if len(messages) > 1 {
+							dispatch[s.topic] = s.messageCandidates(support, messages)
+						}
+						s.warnUnsupported(warned)
+						if p.headersPath != "" {
+							for key, headers := range s.channelHeaders(support, messages, dispatch[s.topic]) {
+								receiveHeaders[key] = headers
+							}
+						}
+						if o.service {
+							for key, method := range s.serviceMethods(support, subscribe, messages, dispatch[s.topic]) {
+								operations[key] = method
 							}
 						}
 						handler := trigger.HandlerConfig{
 							Settings: p.handlerSettings(s),
 						}
+						async := true
+						if p.responses != nil {
+							if handlerResponses := p.responses(s); len(handlerResponses) > 0 {
+								async = false
+								responses = append(responses, handlerResponses...)
+							}
+						}
+						if p.query != nil {
+							if schema := p.query(s); schema != nil {
+								queries[s.topic] = queryParameters(schema)
+							}
+						}
+						if parameters := receivedParameters(s); len(parameters) > 0 {
+							params[s.topic] = parameters
+						}
+						decoders[s.topic] = s.codec(support, "decode")
+						if deadLetter, ok := s.deadLetter(o.deadLetter.merge(deadLetterExtension(channel.AdditionalProperties))); ok {
+							deadLetters[s.topic] = deadLetter
+							if service := s.deadLetterService(deadLetter); service != nil {
+								deadLetterServices[s.topic] = service
+							}
+						}
 						addImport("github.com/project-flogo/microgateway@%s", MicrogatewayVersion)
 						action := action.Config{
 							Ref: "github.com/project-flogo/microgateway",
 							Settings: map[string]interface{}{
 								"uri":   fmt.Sprintf("microgateway:%s", p.name),
-								"async": true,
+								"async": async,
 							},
 						}
 						actionConfig := trigger.ActionConfig{
@@ -349,31 +611,45 @@ func (p protocolConfig) protocol(support *bytes.Buffer, model *models.AsyncAPI20
 						if p.paramsPath != "" {
 							actionConfig.Input["params"] = fmt.Sprintf("=$.%s", p.paramsPath)
 						}
+						if p.headersPath != "" {
+							actionConfig.Input["headers"] = fmt.Sprintf("=$.%s", p.headersPath)
+						}
+						for input, output := range p.outputs {
+							actionConfig.Input[input] = fmt.Sprintf("=$.%s", output)
+						}
 						handler.Actions = append(handler.Actions, &actionConfig)
 						trig.Handlers = append(trig.Handlers, &handler)
 					}
 					if publish != nil && p.activity != "" {
-						if len(publish.Traits) > 0 {
-							s.protocolInfo = make(map[string]interface{})
-							for _, trait := range publish.Traits {
-								if value, ok := trait.(map[string]interface{}); ok {
-									if value, ok := value["bindings"]; ok {
-										if bindings, ok := value.(map[string]interface{}); ok {
-											for key, value := range bindings {
-												s.protocolInfo[key] = value
-											}
-										}
-									}
+						s.protocolInfo = operationBindings(publish)
+						s.message = nil
+						if messages := operationMessages(publish); len(messages) > 0 {
+							s.message = messages[0]
+						}
+						s.warnUnsupported(warned)
+						if settings := p.serviceSettings(s); settings != nil {
+							service := &api.Service{
+								Name:        fmt.Sprintf("%s-name-%s", p.name, name),
+								Ref:         p.activity,
+								Description: fmt.Sprintf("%s service", p.name),
+								Settings:    settings,
+							}
+							encoders[s.topic] = s.codec(support, "encode")
+							publisher := publisher{
+								channel: s.topic,
+								service: service,
+								message: s.message,
+							}
+							if p.serviceHeaders != "" {
+								publisher.headers = s.messageHeaders()
+								if len(publisher.headers) > 0 {
+									publishHeaders[s.topic] = publisher.headers
 								}
 							}
+							publishers = append(publishers, publisher)
+						} else {
+							s.warn(warned, fmt.Sprintf("the publish operation of channel %s", s.topic))
 						}
-						service := &api.Service{
-							Name:        fmt.Sprintf("%s-name-%s", p.name, name),
-							Ref:         p.activity,
-							Description: fmt.Sprintf("%s service", p.name),
-							Settings:    p.serviceSettings(s),
-						}
-						services = append(services, service)
 					}
 				}
 				triggers = append(triggers, &trig)
@@ -385,14 +661,14 @@ func (p protocolConfig) protocol(support *bytes.Buffer, model *models.AsyncAPI20
 		gateway := &api.Microgateway{
 			Name: p.name,
 		}
-		addImport("github.com/project-flogo/contrib/activity/log", "")
+		addImport("github.com/project-flogo/contrib/activity/log@%s", "")
 		service := &api.Service{
 			Name:        "log",
 			Ref:         "github.com/project-flogo/contrib/activity/log",
 			Description: "logging service",
 		}
 		gateway.Services = append(gateway.Services, service)
-		addImport("github.com/nareshkumarthota/flogocomponents/activity/methodinvoker", "")
+		addImport("github.com/nareshkumarthota/flogocomponents/activity/methodinvoker@%s", "")
 		service = &api.Service{
 			Name:        "methodinvoker",
 			Ref:         "github.com/nareshkumarthota/flogocomponents/activity/methodinvoker",
@@ -406,17 +682,67 @@ func (p protocolConfig) protocol(support *bytes.Buffer, model *models.AsyncAPI20
 			},
 		}
 		gateway.Steps = append(gateway.Steps, step)
+		inputData := addMethodStep(gateway, "decode", "decode the message", fmt.Sprintf("%sDecode", p.name), "=$.payload")
+		if len(queries) > 0 {
+			service = &api.Service{
+				Name:        "validate",
+				Ref:         "github.com/nareshkumarthota/flogocomponents/activity/methodinvoker",
+				Description: "validate the query parameters",
+			}
+			gateway.Services = append(gateway.Services, service)
+			step = &api.Step{
+				Service: "validate",
+				Input: map[string]interface{}{
+					"methodName": fmt.Sprintf("%sValidate", p.name),
+					"inputData":  "=$.payload",
+				},
+				HaltCondition: "$.validate.outputs.outputData.valid == false",
+			}
+			gateway.Steps = append(gateway.Steps, step)
+			response := &api.Response{
+				Condition: "$.validate.outputs.outputData.valid == false",
+				Error:     true,
+				Output: api.Output{
+					Code: 400,
+					Data: "=$.validate.outputs.outputData",
+				},
+			}
+			gateway.Responses = append(gateway.Responses, response)
+			writeQueryValidator(support, p.name, queries)
+		}
+		if len(params) > 0 {
+			inputData = addMethodStep(gateway, "params", "extract the channel parameters", fmt.Sprintf("%sParams", p.name), inputData)
+			writeParamsExtractor(support, p.name, params)
+		}
+		method := fmt.Sprintf("%sMethod", p.name)
+		if len(dispatch) > 0 {
+			inputData = addMethodStep(gateway, "dispatch", "select the method of the message", fmt.Sprintf("%sDispatch", p.name), inputData)
+			method = "=$.dispatch.outputs.outputData.method"
+			writeDispatcher(support, p.name, dispatch, o.service)
+		}
+		if len(receiveHeaders) > 0 {
+			inputData = addMethodStep(gateway, "headers", "validate the message headers", fmt.Sprintf("%sHeaders", p.name), inputData)
+			writeHeadersValidator(support, p.name, "Headers", receiveHeaders)
+		}
+		gateway.Responses = append(gateway.Responses, responses...)
+		if len(deadLetters) > 0 {
+			method = fmt.Sprintf("%sInvoke", p.name)
+			writeInvoker(support, p.name, invokedMethods(p.name, dispatch), deadLetters)
+		}
 		step = &api.Step{
 			Service: "methodinvoker",
 			Input: map[string]interface{}{
-				"methodName": fmt.Sprintf("%sMethod", p.name),
-				"inputData":  "=$.payload",
+				"methodName": method,
+				"inputData":  inputData,
 			},
 		}
 		gateway.Steps = append(gateway.Steps, step)
-		fmt.Fprintf(support, "func %sMethod(inputs interface{}) (map[string]interface{}, error) {\n", p.name)
-		fmt.Fprintf(support, "\treturn nil, nil\n")
-		fmt.Fprintf(support, "}\n")
+		p.addDeadLetterSteps(gateway, deadLetterServices)
+		if o.service {
+			writeServiceOperations(support, p.name, operations)
+		} else {
+			support.handler(p.name, p.name+"Method", fmt.Sprintf(handlerStub, p.name+"Method", "the messages of the channels", ""))
+		}
 		fmt.Fprintf(support, "func init() {\n")
 		fmt.Fprintf(support, "\tmethodinvoker.RegisterMethods(\"%sMethod\", %sMethod)\n", p.name, p.name)
 		fmt.Fprintf(support, "}\n")
@@ -434,72 +760,50 @@ func (p protocolConfig) protocol(support *bytes.Buffer, model *models.AsyncAPI20
 		flogo.Triggers = append(flogo.Triggers, triggers...)
 	}
 
-	if len(services) > 0 {
-		addImport("github.com/project-flogo/contrib/trigger/rest", "")
-		trig := trigger.Config{
-			Id:  fmt.Sprintf("%sPublish", p.name),
-			Ref: "github.com/project-flogo/contrib/trigger/rest",
-			Settings: map[string]interface{}{
-				"port": p.port,
-			},
-		}
-		handler := trigger.HandlerConfig{
-			Settings: map[string]interface{}{
-				"method": "POST",
-				"path":   "/post",
-			},
-		}
-		addImport("github.com/project-flogo/microgateway@%s", MicrogatewayVersion)
-		action := action.Config{
-			Ref: "github.com/project-flogo/microgateway",
-			Settings: map[string]interface{}{
-				"uri":   fmt.Sprintf("microgateway:%sPublish", p.name),
-				"async": true,
-			},
-		}
-		actionConfig := trigger.ActionConfig{
-			Config: &action,
-		}
-		handler.Actions = append(handler.Actions, &actionConfig)
-		trig.Handlers = append(trig.Handlers, &handler)
-		flogo.Triggers = append(flogo.Triggers, &trig)
-
-		gateway := &api.Microgateway{
-			Name: fmt.Sprintf("%sPublish", p.name),
-		}
-		addImport("github.com/project-flogo/contrib/activity/log", "")
-		service := &api.Service{
-			Name:        "log",
-			Ref:         "github.com/project-flogo/contrib/activity/log",
-			Description: "logging service",
-		}
-		gateway.Services = append(services, service)
-		step := &api.Step{
-			Service: "log",
-			Input: map[string]interface{}{
-				"message": "=$.payload.content",
-			},
-		}
-		gateway.Steps = append(gateway.Steps, step)
-
-		raw, err := json.Marshal(gateway)
-		if err != nil {
-			panic(err)
-		}
+	if len(publishers) > 0 {
+		p.bridge(flogo, model, publishers, o.ports, addImport)
+	}
 
-		res := &resource.Config{
-			ID:   fmt.Sprintf("microgateway:%sPublish", p.name),
-			Data: raw,
-		}
-		flogo.Resources = append(flogo.Resources, res)
+	if len(triggers) > 0 || len(publishers) > 0 {
+		writeCodec(support, p.name, decoders, encoders)
+	}
+	if len(publishHeaders) > 0 {
+		writeHeadersValidator(support, p.name, "PublishHeaders", publishHeaders)
 	}
 }
 
-func convert(input, role string) (*bytes.Buffer, *app.Config) {
-	model, err := models.Parse(input)
-	if err != nil {
-		panic(err)
+// addMethodStep adds a step invoking a support method, the gateway halts with a 400 response if the outputs are invalid
+func addMethodStep(gateway *api.Microgateway, name, description, method, inputData string) string {
+	service := &api.Service{
+		Name:        name,
+		Ref:         "github.com/nareshkumarthota/flogocomponents/activity/methodinvoker",
+		Description: description,
+	}
+	gateway.Services = append(gateway.Services, service)
+	step := &api.Step{
+		Service: name,
+		Input: map[string]interface{}{
+			"methodName": method,
+			"inputData":  inputData,
+		},
+		HaltCondition: fmt.Sprintf("$.%s.outputs.outputData.valid == false", name),
+	}
+	gateway.Steps = append(gateway.Steps, step)
+	response := &api.Response{
+		Condition: fmt.Sprintf("$.%s.outputs.outputData.valid == false", name),
+		Error:     true,
+		Output: api.Output{
+			Code: 400,
+			Data: fmt.Sprintf("=$.%s.outputs.outputData.error", name),
+		},
 	}
+	gateway.Responses = append(gateway.Responses, response)
+	return fmt.Sprintf("=$.%s.outputs.outputData", name)
+}
+
+func convert(input string, o options) (*supportCode, *app.Config) {
+	o.directory = filepath.Dir(inputFiles(input)[0])
+	model := parse(input, &o)
 
 	flogo := app.Config{}
 	flogo.Name = model.Id
@@ -509,42 +813,80 @@ func convert(input, role string) (*bytes.Buffer, *app.Config) {
 	flogo.AppModel = "1.1.0"
 
 	var schemes map[string]interface{}
-	if model.Components.SecuritySchemes != nil {
+	if model.Components != nil && model.Components.SecuritySchemes != nil {
 		schemes = model.Components.SecuritySchemes.AdditionalProperties
 	}
 
-	support := bytes.Buffer{}
-	fmt.Fprintf(&support, "package main\n")
-	fmt.Fprintf(&support, "import \"github.com/nareshkumarthota/flogocomponents/activity/methodinvoker\"\n")
+	if service, ok := model.AdditionalProperties["x-service"].(bool); ok {
+		o.service = service
+	}
+
+	support := supportCode{}
+	support.addImport("github.com/nareshkumarthota/flogocomponents/activity/methodinvoker")
+	o.ports = make(listenPorts)
+	for _, config := range configs {
+		config.protocol(&support, &model, schemes, &flogo, o)
+	}
+	// the client sides of the loopback app listen on the ports the server sides leave free
 	for _, config := range configs {
-		config.protocol(&support, &model, schemes, &flogo, role)
+		if o.loopback(&model, config) {
+			config.loopback = true
+			config.protocol(&support, &model, schemes, &flogo, o)
+		}
 	}
+	writeService(&support)
+	importSupportModules(&support, &flogo, o.versions)
 
 	return &support, &flogo
 }
 
+// importSupportModules imports the modules of the support code like the triggers and activities,
+// so the go.mod of every conversion type requires them
+func importSupportModules(support *supportCode, flogo *app.Config, lock versionLock) {
+	for _, port := range support.imports {
+		for module, version := range supportModules {
+			if port != module && !strings.HasPrefix(port, module+"/") {
+				continue
+			}
+			path := fmt.Sprintf("%s@%s", module, lock.version(module, version))
+			if relative := strings.TrimPrefix(port, module); relative != "" {
+				path += ":" + relative
+			}
+			found := false
+			for _, existing := range flogo.Imports {
+				found = found || existing == path
+			}
+			if !found {
+				flogo.Imports = append(flogo.Imports, path)
+			}
+		}
+	}
+}
+
 // ToAPI converts an asyn api to a API flogo application
 func ToAPI(input, output, role string) {
-	support, flogo := convert(input, role)
-	err := ioutil.WriteFile(output+"/support.go", support.Bytes(), 0644)
-	if err != nil {
-		panic(err)
-	}
-	microgateway.Generate(flogo, output+"/app.go", output+"/go.mod")
+	toAPI(Config{Input: input, Output: output, Role: role})
+}
+
+func toAPI(config Config) {
+	support, flogo := convert(config.Input, config.options())
+	support.write(config.Output)
+	microgateway.Generate(flogo, filepath.Join(config.Output, layout(config.Layout.App, "app.go")), config.Output+"/go.mod")
 }
 
 // ToJSON converts an async api to a JSON flogo application
 func ToJSON(input, output, role string) {
-	support, flogo := convert(input, role)
-	err := ioutil.WriteFile(output+"/support.go", support.Bytes(), 0644)
-	if err != nil {
-		panic(err)
-	}
+	toJSON(Config{Input: input, Output: output, Role: role})
+}
+
+func toJSON(config Config) {
+	support, flogo := convert(config.Input, config.options())
+	support.write(config.Output)
 	data, err := json.MarshalIndent(flogo, "", "  ")
 	if err != nil {
 		panic(err)
 	}
-	err = ioutil.WriteFile(output+"/flogo.json", data, 0644)
+	err = ioutil.WriteFile(filepath.Join(config.Output, layout(config.Layout.Descriptor, "flogo.json")), data, 0644)
 	if err != nil {
 		panic(err)
 	}
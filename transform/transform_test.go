@@ -0,0 +1,1767 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/project-flogo/asyncapi/transform/models"
+	"github.com/project-flogo/core/app"
+	"github.com/project-flogo/core/trigger"
+	"github.com/project-flogo/microgateway/api"
+)
+
+// convertSpec converts a spec held in a string
+func convertSpec(t *testing.T, spec, role string) (*supportCode, *app.Config) {
+	return convertSpecOptions(t, spec, options{role: role})
+}
+
+// convertSpecOptions converts a spec held in a string with the given options
+func convertSpecOptions(t *testing.T, spec string, o options) (*supportCode, *app.Config) {
+	tmp, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	input := filepath.Join(tmp, "asyncapi.yml")
+	err = ioutil.WriteFile(input, []byte(spec), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return convert(input, o)
+}
+
+// getTrigger returns the trigger with the given id
+func getTrigger(t *testing.T, flogo *app.Config, id string) *trigger.Config {
+	for _, trig := range flogo.Triggers {
+		if trig.Id == id {
+			return trig
+		}
+	}
+	t.Fatalf("trigger %s not found", id)
+	return nil
+}
+
+// getGateway returns the microgateway resource with the given id
+func getGateway(t *testing.T, flogo *app.Config, id string) *api.Microgateway {
+	for _, res := range flogo.Resources {
+		if res.ID == id {
+			gateway := api.Microgateway{}
+			err := json.Unmarshal(res.Data, &gateway)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return &gateway
+		}
+	}
+	t.Fatalf("resource %s not found", id)
+	return nil
+}
+
+// captureWarnings returns the warnings printed while f runs
+func captureWarnings(t *testing.T, f func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = writer
+	defer func() {
+		os.Stderr = stderr
+	}()
+	output := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(reader)
+		output <- string(data)
+	}()
+	f()
+	writer.Close()
+	return <-output
+}
+
+// protocolCase is a spec converted with a role and the settings it should generate
+type protocolCase struct {
+	name, spec, role string
+	trigger, ref     string
+	settings         map[string]interface{}
+	handler, input   map[string]interface{}
+	gateway, service string
+	serviceSettings  map[string]interface{}
+	warnings         []string
+	quiet            bool
+	accepted         map[string][]string
+}
+
+// checkSettings checks that the settings hold the expected values and are accepted by the module
+func checkSettings(t *testing.T, kind string, settings, expected map[string]interface{}, accepted map[string][]string) {
+	for name, value := range expected {
+		if fmt.Sprint(settings[name]) != fmt.Sprint(value) {
+			t.Fatalf("the %s setting %s should be %v not %v", kind, name, value, settings[name])
+		}
+	}
+	if names, ok := accepted[kind]; ok {
+		for name := range settings {
+			found := false
+			for _, accepted := range names {
+				found = found || name == accepted
+			}
+			if !found {
+				t.Fatalf("the %s setting %s is not accepted by the module", kind, name)
+			}
+		}
+	}
+}
+
+// testProtocol converts the spec of each case and checks the generated trigger, handler and service
+func testProtocol(t *testing.T, cases []protocolCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var flogo *app.Config
+			warnings := captureWarnings(t, func() {
+				_, flogo = convertSpec(t, c.spec, c.role)
+			})
+			trig := getTrigger(t, flogo, c.trigger)
+			if c.ref != "" && trig.Ref != c.ref {
+				t.Fatalf("%s should use %s not %s", c.trigger, c.ref, trig.Ref)
+			}
+			checkSettings(t, "trigger", trig.Settings, c.settings, c.accepted)
+			if c.handler != nil {
+				if len(trig.Handlers) == 0 {
+					t.Fatalf("%s has no handler", c.trigger)
+				}
+				checkSettings(t, "handler", trig.Handlers[0].Settings, c.handler, c.accepted)
+			}
+			if c.input != nil {
+				checkSettings(t, "input", trig.Handlers[0].Actions[0].Input, c.input, nil)
+			}
+			if c.service != "" {
+				found := false
+				for _, service := range getGateway(t, flogo, c.gateway).Services {
+					if service.Name == c.service {
+						found = true
+						checkSettings(t, "service", service.Settings, c.serviceSettings, c.accepted)
+					}
+				}
+				if !found {
+					t.Fatalf("service %s not found", c.service)
+				}
+			}
+			for _, warning := range c.warnings {
+				if !strings.Contains(warnings, warning) {
+					t.Fatalf("the warnings should contain %s, not %s", warning, warnings)
+				}
+			}
+			if c.quiet && warnings != "" {
+				t.Fatalf("the conversion should not warn, not %s", warnings)
+			}
+		})
+	}
+}
+
+const bridgeSpec = `asyncapi: '2.0.0'
+id: 'urn:com:bridge:server'
+info:
+  title: Bridge Application
+  version: '1.0.0'
+x-publish-bridge:
+  port: 9000
+servers:
+  mqtt:
+    url: tcp://localhost:1883
+    protocol: mqtt
+  kafka:
+    url: localhost:9092
+    protocol: kafka
+channels:
+  /a:
+    publish:
+      message:
+        payload:
+          type: object
+  /b/{id}:
+    parameters:
+      id:
+        schema:
+          type: string
+    publish:
+      message:
+        payload:
+          type: object
+`
+
+func TestBridge(t *testing.T) {
+	_, flogo := convertSpec(t, bridgeSpec, "server")
+
+	trig := getTrigger(t, flogo, "publish")
+	if port := trig.Settings["port"]; port != 9000 {
+		t.Fatalf("port should be 9000 not %v", port)
+	}
+	if length := len(trig.Handlers); length != 4 {
+		t.Fatalf("there should be 4 handlers not %d", length)
+	}
+	paths := make(map[string]bool)
+	for _, handler := range trig.Handlers {
+		path := handler.Settings["path"].(string)
+		if paths[path] {
+			t.Fatalf("path %s is routed twice", path)
+		}
+		paths[path] = true
+	}
+	for _, path := range []string{"/publish/mqtt/a", "/publish/mqtt/b/:id", "/publish/kafka/a", "/publish/kafka/b/:id"} {
+		if !paths[path] {
+			t.Fatalf("path %s not found", path)
+		}
+	}
+
+	for _, protocol := range []string{"mqtt", "kafka"} {
+		gateway := getGateway(t, flogo, "microgateway:"+protocol+"Publish")
+		routed := 0
+		for _, step := range gateway.Steps {
+			if step.Service == "log" || step.Service == "encode" {
+				continue
+			}
+			if step.Condition == "" {
+				t.Fatalf("step %s should be routed by channel", step.Service)
+			}
+			routed++
+		}
+		if routed != 2 {
+			t.Fatalf("there should be 2 routed steps not %d", routed)
+		}
+	}
+}
+
+func TestChannelParameters(t *testing.T) {
+	s := settings{
+		protocolConfig: protocolKafka,
+		topic:          "/user/{userId}/{kind}",
+		parameters: map[string]*models.Parameter{
+			"userId": {
+				Schema: map[string]interface{}{
+					"type": "integer",
+				},
+				Location: "$message.payload#/user/id",
+			},
+			"kind": {
+				Schema: map[string]interface{}{
+					"type": "string",
+					"enum": []interface{}{"a", "b"},
+				},
+			},
+		},
+	}
+	if length := len(channelParameters(s)); length != 2 {
+		t.Fatalf("the channel should have 2 parameters not %d", length)
+	}
+	parameters := receivedParameters(s)
+	if length := len(parameters); length != 1 {
+		t.Fatalf("there should be 1 received parameter not %d", length)
+	}
+	if parameter := parameters[0]; parameter.name != "userId" || parameter.typ != "integer" ||
+		parameter.source != "message" || parameter.pointer != "/user/id" {
+		t.Fatalf("invalid parameter %+v", parameter)
+	}
+
+	s.protocolConfig = protocolHTTP
+	parameters = receivedParameters(s)
+	if length := len(parameters); length != 2 {
+		t.Fatalf("there should be 2 parameters not %d", length)
+	}
+	if parameter := parameters[1]; parameter.name != "kind" || parameter.source != "" || len(parameter.enum) != 2 {
+		t.Fatalf("invalid parameter %+v", parameter)
+	}
+}
+
+func TestDestination(t *testing.T) {
+	tests := []struct {
+		rules       string
+		channel     string
+		destination string
+	}{
+		{"separator=.", "/user/{id}/Signup", "user.{id}.Signup"},
+		{"separator=.,case=lower,prefix=acme.", "/user/{userId}/Signup", "acme.user.{userId}.signup"},
+		{"separator=_,template={protocol}-{channel}", "/a/b", "kafka-a_b"},
+		{"", "/a/b", "a/b"},
+	}
+	for _, test := range tests {
+		rules := destinationRules{separator: "/"}.merge(parseDestinationRules(test.rules))
+		destination := rules.destination(test.channel, "kafka", "production")
+		if destination != test.destination {
+			t.Fatalf("destination of %s should be %s not %s", test.channel, test.destination, destination)
+		}
+	}
+
+	destination, _ := destinationExtension(map[string]interface{}{"x-destination": "legacy.topic"})
+	if destination != "legacy.topic" {
+		t.Fatalf("destination should be legacy.topic not %s", destination)
+	}
+	_, rules := destinationExtension(map[string]interface{}{
+		"x-destination": map[string]interface{}{"separator": "-", "case": "upper"},
+	})
+	if destination := rules.destination("/a/b", "mqtt", ""); destination != "A-B" {
+		t.Fatalf("destination should be A-B not %s", destination)
+	}
+
+	_, flogo := convertSpecOptions(t, loopbackSpec, options{role: "both", destination: parseDestinationRules("template={protocol}-{channel}")})
+	for _, id := range []string{"kafkalocal", "kafkaClientlocal"} {
+		if topic := getTrigger(t, flogo, id).Handlers[0].Settings["topic"]; topic != "kafka-orders" {
+			t.Fatalf("topic of %s should be kafka-orders not %v", id, topic)
+		}
+	}
+}
+
+func TestMessageCodec(t *testing.T) {
+	tests := []struct {
+		defaultContentType string
+		message            map[string]interface{}
+		codec              string
+	}{
+		{"", nil, "json"},
+		{"application/xml", nil, "xml"},
+		{"application/xml", map[string]interface{}{"contentType": "text/plain; charset=utf-8"}, "text"},
+		{"", map[string]interface{}{"contentType": "application/cloudevents+json"}, "json"},
+		{"", map[string]interface{}{"traits": []interface{}{
+			map[string]interface{}{"contentType": "application/octet-stream"},
+		}}, "binary"},
+	}
+	for _, test := range tests {
+		s := settings{
+			defaultContentType: test.defaultContentType,
+			message:            test.message,
+		}
+		if codec := s.messageCodec(); codec != test.codec {
+			t.Fatalf("codec of %s should be %s not %s", s.contentType(), test.codec, codec)
+		}
+	}
+}
+
+func TestAvroGoType(t *testing.T) {
+	support := supportCode{}
+	schema := map[string]interface{}{
+		"type":      "record",
+		"name":      "UserSignedUp",
+		"namespace": "com.example",
+		"fields": []interface{}{
+			map[string]interface{}{"name": "user_id", "type": "long"},
+			map[string]interface{}{"name": "displayName", "type": []interface{}{"null", "string"}},
+			map[string]interface{}{"name": "tags", "type": map[string]interface{}{"type": "array", "items": "string"}},
+			map[string]interface{}{"name": "address", "type": map[string]interface{}{
+				"type":   "record",
+				"name":   "Address",
+				"fields": []interface{}{map[string]interface{}{"name": "city", "type": "string"}},
+			}},
+		},
+	}
+	if typ := avroGoType(&support, schema); typ != "UserSignedUp" {
+		t.Fatalf("type should be UserSignedUp not %s", typ)
+	}
+	code := support.String()
+	for _, expected := range []string{
+		"type Address struct {\n\tCity string `json:\"city\"`\n}\n",
+		"\tUserId int64 `json:\"user_id\"`\n",
+		"\tDisplayName *string `json:\"displayName\"`\n",
+		"\tTags []string `json:\"tags\"`\n",
+		"\tAddress Address `json:\"address\"`\n",
+		"func DecodeUserSignedUp(message interface{}) (*UserSignedUp, error) {\n",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Fatalf("%s not found in %s", expected, code)
+		}
+	}
+}
+
+func TestParseProto(t *testing.T) {
+	definition := parseProto("user.proto", `syntax = "proto3";
+package example;
+import "google/protobuf/timestamp.proto";
+/* a user */
+message User {
+  int64 id = 1; // the id
+  repeated Address addresses = 2 [deprecated = true];
+  map<string, int32> scores = 3;
+  Status status = 4;
+  oneof contact {
+    string email = 5;
+    string phone = 6;
+  }
+  google.protobuf.Timestamp created = 7;
+  message Address {
+    string city = 1;
+  }
+}
+enum Status {
+  UNKNOWN = 0;
+}
+`, "")
+	if definition.pkg != "example" {
+		t.Fatalf("package should be example not %s", definition.pkg)
+	}
+	user := definition.names["User"]
+	if user == nil || len(user.fields) != 7 {
+		t.Fatalf("User should have 7 fields")
+	}
+	if field := user.fields[2]; field.key != "string" || field.typ != "int32" || field.number != 3 {
+		t.Fatalf("invalid map field %+v", field)
+	}
+	if typ := user.fields[1].typ; typ != "User.Address" {
+		t.Fatalf("Address should resolve to User.Address not %s", typ)
+	}
+	if typ := user.fields[3].typ; typ != "enum" {
+		t.Fatalf("Status should resolve to enum not %s", typ)
+	}
+	if typ := user.fields[6].typ; typ != "Timestamp" || definition.names[typ] == nil {
+		t.Fatalf("created should resolve to the imported Timestamp not %s", typ)
+	}
+	if names := []string{definition.messages[0].name, definition.messages[1].name}; names[0] != "User" || names[1] != "User.Address" {
+		t.Fatalf("messages should be User and User.Address not %v", names)
+	}
+
+	support := supportCode{}
+	file := support.file("proto.go")
+	if typ := writeProtoMessage(&support, file, definition, user); typ != "User" {
+		t.Fatalf("type should be User not %s", typ)
+	}
+	code := file.String()
+	for _, expected := range []string{
+		"\tAddresses []*UserAddress `json:\"addresses\"`\n",
+		"\tScores map[string]int32 `json:\"scores\"`\n",
+		"\tStatus int32 `json:\"status\"`\n",
+		"\tCreated *Timestamp `json:\"created\"`\n",
+		"type UserAddress struct {\n",
+		"type Timestamp struct {\n",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Fatalf("%s not found in %s", expected, code)
+		}
+	}
+}
+
+func TestSupportModules(t *testing.T) {
+	for example, expected := range map[string]string{
+		"../examples/avro/asyncapi.yml":     "github.com/linkedin/goavro/v2@v2.9.8",
+		"../examples/protobuf/asyncapi.yml": "google.golang.org/protobuf@v1.27.1:/encoding/protowire",
+	} {
+		_, flogo := convert(example, options{role: "server", versions: versionLock{}})
+		if imports := strings.Join(flogo.Imports, "\n"); !strings.Contains(imports, expected) {
+			t.Fatalf("the imports of %s should contain %s, not %s", example, expected, imports)
+		}
+	}
+	lock := versionLock{"google.golang.org/protobuf": "v1.34.2"}
+	_, flogo := convert("../examples/protobuf/asyncapi.yml", options{role: "server", versions: lock})
+	if imports := strings.Join(flogo.Imports, "\n"); !strings.Contains(imports, "google.golang.org/protobuf@v1.34.2:/encoding/protowire") {
+		t.Fatalf("the version lock should pin protobuf, not %s", imports)
+	}
+}
+
+const dispatchSpec = `asyncapi: '2.0.0'
+id: 'urn:com:dispatch:server'
+info:
+  title: Dispatch Application
+  version: '1.0.0'
+servers:
+  http:
+    url: http://localhost:9000
+    protocol: http
+channels:
+  /events:
+    subscribe:
+      message:
+        oneOf:
+          - name: created
+            payload:
+              type: object
+              discriminator: kind
+              required: [kind, id]
+              properties:
+                kind:
+                  type: string
+                id:
+                  type: integer
+          - name: renamed
+            headers:
+              type: object
+              properties:
+                event:
+                  type: string
+                  enum: [renamed]
+            payload:
+              type: object
+              properties:
+                name:
+                  type: string
+  /single:
+    subscribe:
+      message:
+        payload:
+          type: object
+`
+
+func TestMessageDispatch(t *testing.T) {
+	support, flogo := convertSpec(t, dispatchSpec, "server")
+	gateway := getGateway(t, flogo, "microgateway:http")
+	step := gateway.Steps[len(gateway.Steps)-1]
+	if method := step.Input["methodName"]; method != "=$.dispatch.outputs.outputData.method" {
+		t.Fatalf("method should be selected by the dispatcher not %v", method)
+	}
+	code := support.String() + string(support.handlerStubs("http_handlers.go", nil))
+	for _, expected := range []string{
+		`{name: "created", method: "httpCreatedMethod", discriminator: "kind", value: "created", required: []string{"kind", "id"}}`,
+		`{name: "renamed", method: "httpRenamedMethod", headers: map[string]string{"event": "renamed"}}`,
+		"payload, err := DecodeCreated(values[\"message\"])",
+		"func httpDeadLetter(",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Fatalf("support code should contain %s", expected)
+		}
+	}
+	if strings.Contains(code, `"/single": {`) {
+		t.Fatal("channels with a single message shouldn't be dispatched")
+	}
+}
+
+const headersSpec = `asyncapi: '2.0.0'
+id: 'urn:com:headers:server'
+info:
+  title: Headers Application
+  version: '1.0.0'
+servers:
+  http:
+    url: http://localhost:9000
+    protocol: http
+channels:
+  /lights:
+    subscribe:
+      message:
+        $ref: '#/components/messages/light'
+    publish:
+      message:
+        $ref: '#/components/messages/light'
+components:
+  messages:
+    light:
+      name: light
+      traits:
+        - $ref: '#/components/messageTraits/commonHeaders'
+      payload:
+        type: object
+  messageTraits:
+    commonHeaders:
+      headers:
+        type: object
+        required: [my-app-header]
+        properties:
+          my-app-header:
+            type: integer
+            minimum: 0
+            maximum: 100
+            default: 1
+`
+
+func TestMessageHeaders(t *testing.T) {
+	support, flogo := convertSpec(t, headersSpec, "server")
+	gateway := getGateway(t, flogo, "microgateway:http")
+	step := gateway.Steps[len(gateway.Steps)-1]
+	if input := step.Input["inputData"]; input != "=$.headers.outputs.outputData" {
+		t.Fatalf("method should receive the validated headers not %v", input)
+	}
+	code := support.String()
+	expected := `{name: "my-app-header", typ: "integer", required: true, def: "1", minimum: "0", maximum: "100"}`
+	if !strings.Contains(code, "var httpHeadersSchema = map[string][]messageHeader{\n\t\"/lights\": {\n\t\t"+expected) {
+		t.Fatal("support code should contain the headers schema of the channel")
+	}
+	if !strings.Contains(code, "type LightHeaders struct {\n\tMyAppHeader int64 `json:\"my-app-header\"`\n}") {
+		t.Fatal("support code should contain the headers type of the message")
+	}
+	bridge := getGateway(t, flogo, "microgateway:httpPublish")
+	service := bridge.Steps[len(bridge.Steps)-1]
+	if input := service.Input["headers"]; input != "=$.headers.outputs.outputData.headers" {
+		t.Fatalf("publish service should set the headers not %v", input)
+	}
+}
+
+const deadLetterSpec = `asyncapi: '2.0.0'
+id: 'urn:com:deadletter:server'
+info:
+  title: Dead Letter Application
+  version: '1.0.0'
+servers:
+  mqtt:
+    url: tcp://localhost:1883
+    protocol: mqtt
+channels:
+  /a:
+    subscribe:
+      message:
+        payload:
+          type: object
+  /b:
+    x-dead-letter:
+      destination: failed/{channel}
+      retries: 5
+    subscribe:
+      message:
+        payload:
+          type: object
+  /c:
+    x-dead-letter: false
+    subscribe:
+      message:
+        payload:
+          type: object
+`
+
+func TestDeadLetter(t *testing.T) {
+	support, flogo := convertSpecOptions(t, deadLetterSpec, options{role: "server", deadLetter: parseDeadLetterRules("backoff=2s")})
+	code := support.String()
+	for _, expected := range []string{
+		`"/a": {retries: 3, backoff: "2s"},`,
+		`"/b": {retries: 5, backoff: "2s"},`,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Fatalf("support code should contain %s", expected)
+		}
+	}
+	if strings.Contains(code, `"/c": {retries`) {
+		t.Fatal("channel /c shouldn't be retried")
+	}
+	if !strings.Contains(code, "policy, deadLetter := mqttRetries[channel]\n\tif !deadLetter {") {
+		t.Fatal("the errors of channel /c should be returned to the trigger")
+	}
+	gateway := getGateway(t, flogo, "microgateway:mqtt")
+	destinations := make(map[string]interface{})
+	for _, step := range gateway.Steps {
+		if step.Service == "methodinvoker" && step.Input["methodName"] != "mqttInvoke" {
+			t.Fatalf("method should be invoked with retries not %v", step.Input["methodName"])
+		}
+		for _, service := range gateway.Services {
+			if service.Name == step.Service && strings.HasPrefix(service.Name, "mqtt-deadletter-") {
+				if input := step.Input["message"]; input != "=$.methodinvoker.outputs.outputData.deadLetterMessage" {
+					t.Fatalf("dead-letter service should publish the dead-letter message not %v", input)
+				}
+				destinations[service.Name] = service.Settings["topic"]
+			}
+		}
+	}
+	if len(destinations) != 2 || destinations["mqtt-deadletter-/a"] != "a/dlq" || destinations["mqtt-deadletter-/b"] != "failed/b" {
+		t.Fatalf("invalid dead-letter destinations %v", destinations)
+	}
+}
+
+func TestRegeneration(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	support, _ := convertSpec(t, dispatchSpec, "server")
+	support.write(tmp)
+	path := filepath.Join(tmp, "http_handlers.go")
+	handlers, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(handlers), "func httpMethod(inputs interface{}) (map[string]interface{}, error) {\n",
+		"func httpMethod(inputs interface{}) (map[string]interface{}, error) {\n\t// user code\n", 1)
+	edited = strings.Replace(edited, "func httpCreatedMethod(", "func httpRemovedMethod(", 1)
+	err = ioutil.WriteFile(path, []byte(edited), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	support, _ = convertSpec(t, dispatchSpec, "server")
+	support.write(tmp)
+	handlers, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(handlers)
+	if !strings.HasPrefix(code, edited) {
+		t.Fatal("the handlers file should be kept")
+	}
+	if strings.Count(code, "func httpCreatedMethod(") != 1 || strings.Count(code, "func httpMethod(") != 1 {
+		t.Fatal("only the stubs of the missing handlers should be appended")
+	}
+	if _, err := os.Stat(filepath.Join(tmp, generatedFile)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const serviceSpec = `asyncapi: '2.0.0'
+id: 'urn:com:service:server'
+info:
+  title: Service Application
+  version: '1.0.0'
+x-service: true
+servers:
+  mqtt:
+    url: tcp://localhost:1883
+    protocol: mqtt
+  kafka:
+    url: localhost:9092
+    protocol: kafka
+channels:
+  /light/on:
+    subscribe:
+      operationId: turnOn
+      message:
+        name: turnOnOffPayload
+        payload:
+          type: object
+          properties:
+            command:
+              type: string
+  /events:
+    subscribe:
+      operationId: events
+      message:
+        oneOf:
+          - name: created
+            payload:
+              type: object
+              discriminator: kind
+              properties:
+                kind:
+                  type: string
+          - name: removed
+`
+
+func TestService(t *testing.T) {
+	support, _ := convertSpec(t, serviceSpec, "server")
+	code := support.String()
+	for _, expected := range []string{
+		"\tTurnOn(ctx context.Context, payload TurnOnOffPayload) error\n",
+		"\tEventsCreated(ctx context.Context, payload Created) error\n",
+		"\tEventsRemoved(ctx context.Context, payload interface{}) error\n",
+		"var kafkaOperations = map[string]serviceOperation{\n",
+		"var mqttOperations = map[string]serviceOperation{\n",
+		"\t\treturn service.TurnOn(ctx, *payload)\n",
+		"return invokeOperation(kafkaOperations, \"created\", inputs)",
+		"return nil, fmt.Errorf(\"no operation handles %s\", channel)",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Fatalf("support code should contain %s", expected)
+		}
+	}
+	if strings.Count(code, "\tTurnOn(ctx") != 1 {
+		t.Fatal("the protocols should share the methods of the service")
+	}
+	stubs := string(support.handlerStubs(serviceFile, nil))
+	if !strings.Contains(stubs, "func (s *service) TurnOn(ctx context.Context, payload TurnOnOffPayload) error {") {
+		t.Fatal("the service file should get the stubs of the service methods")
+	}
+	handlers := string(support.handlerStubs("kafka_handlers.go", nil))
+	if strings.Contains(handlers, "func kafkaMethod(") || !strings.Contains(handlers, "func kafkaDeadLetter(") {
+		t.Fatal("only the dead-letter handler should be left to the handlers file")
+	}
+}
+
+func TestGoClient(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	input := filepath.Join(tmp, "asyncapi.yml")
+	err = ioutil.WriteFile(input, []byte(strings.Replace(serviceSpec, "/light/on", "/light/{id}/on", 1)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := goClient(input, options{role: "client"})
+	code := c.support.String()
+	for _, expected := range []string{
+		"func (c *Client) PublishTurnOn(ctx context.Context, id string, payload TurnOnOffPayload) error {\n",
+		"func (c *Client) PublishEvents(ctx context.Context, payload interface{}) error {\n",
+		"\t\t{server: \"kafka\", destination: \"light.{id}.on\", codec: \"json\"},\n",
+		"\t\t{server: \"mqtt\", destination: \"light/{id}/on\", codec: \"json\"},\n",
+		"func newKafkaTransport(",
+		"func newMqttTransport(",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Fatalf("client code should contain %s", expected)
+		}
+	}
+	if strings.Contains(code, "methodinvoker") || strings.Contains(code, "func (c *Client) Subscribe") {
+		t.Fatal("the client should only publish to the channels the server subscribes to")
+	}
+	if c.support.pkg != "serviceapplication" {
+		t.Fatalf("invalid package name %s", c.support.pkg)
+	}
+	if mod := string(c.goMod()); !strings.Contains(mod, "\tgithub.com/Shopify/sarama v1.29.0\n") {
+		t.Fatalf("go.mod should require the kafka client, not %s", mod)
+	}
+}
+
+const httpsClientSpec = `asyncapi: '2.0.0'
+id: 'urn:com:https:client'
+info:
+  title: Secure
+  version: '1.0.0'
+servers:
+  api:
+    url: https://localhost:{port}
+    protocol: https
+    variables:
+      port:
+        default: '9443'
+channels:
+  /events:
+    publish:
+      message:
+        payload:
+          type: object
+    subscribe:
+      message:
+        payload:
+          type: object
+`
+
+// httpsClientTest runs in the package of the generated client
+const httpsClientTest = `package secure
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	port := WithApiPort(os.Getenv("HTTPS_PORT"))
+	client, err := New(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	err = client.SubscribeEvents(context.Background(), func(ctx context.Context, payload interface{}) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "server certificate") {
+		t.Fatalf("https subscribe without a certificate should fail, not %v", err)
+	}
+
+	certificate := httptest.NewUnstartedServer(nil)
+	certificate.StartTLS()
+	defer certificate.Close()
+	config := &tls.Config{Certificates: certificate.TLS.Certificates, InsecureSkipVerify: true}
+	secure, err := New(port, WithTLS(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secure.Close()
+	received := make(chan interface{}, 1)
+	err = secure.SubscribeEvents(context.Background(), func(ctx context.Context, payload interface{}) error {
+		received <- payload
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := secure.PublishEvents(context.Background(), map[string]interface{}{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case payload := <-received:
+		if fmt.Sprint(payload) != "map[id:1]" {
+			t.Fatalf("invalid payload %v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message wasn't received over https")
+	}
+
+	other, err := New(port, WithTLS(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	err = other.SubscribeEvents(context.Background(), func(ctx context.Context, payload interface{}) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "address already in use") {
+		t.Fatalf("subscribing on a port in use should fail, not %v", err)
+	}
+}
+`
+
+func TestHTTPClientServe(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go isn't installed")
+	}
+	tmp, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	input := filepath.Join(tmp, "asyncapi.yml")
+	err = ioutil.WriteFile(input, []byte(httpsClientSpec), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toGoClient(Config{Input: input, Output: tmp, Role: "client"})
+	err = ioutil.WriteFile(filepath.Join(tmp, "client_test.go"), []byte(httpsClientTest), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	command := exec.Command("go", "test", ".")
+	command.Dir = tmp
+	command.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "HTTPS_PORT="+port)
+	if output, err := command.CombinedOutput(); err != nil {
+		t.Fatalf("the generated https client failed: %v\n%s", err, output)
+	}
+}
+
+func TestVersionLock(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	input := filepath.Join(tmp, "asyncapi.yml")
+	err = ioutil.WriteFile(input, []byte(serviceSpec), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := filepath.Join(tmp, "versions.lock")
+	err = ioutil.WriteFile(versions, []byte(`# pinned modules
+github.com/project-flogo/contrib/trigger/kafka v0.10.0
+require github.com/project-flogo/contrib/activity/log v0.10.1 // comment
+require (
+	github.com/project-flogo/core v1.0.0
+	github.com/nareshkumarthota/flogocomponents v0.0.1
+)
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := readVersionLock(versions)
+	support, flogo := convert(input, options{role: "server", versions: lock})
+	imports := strings.Join(flogo.Imports, "\n")
+	for _, expected := range []string{
+		"github.com/project-flogo/contrib/trigger/kafka@v0.10.0",
+		"github.com/project-flogo/contrib/activity/log@v0.10.1",
+		"github.com/project-flogo/microgateway@" + MicrogatewayVersion,
+	} {
+		if !strings.Contains(imports, expected) {
+			t.Fatalf("imports should contain %s, not %s", expected, imports)
+		}
+	}
+	mod := string(goMod("service", moduleRequires(flogo, support, lock, versions)))
+	for _, expected := range []string{
+		"module service\n",
+		"\tgithub.com/project-flogo/contrib/trigger/kafka v0.10.0\n",
+		"\tgithub.com/project-flogo/contrib/activity/log v0.10.1\n",
+		"\tgithub.com/project-flogo/core v1.0.0\n",
+		"\tgithub.com/nareshkumarthota/flogocomponents v0.0.1\n",
+		"\tgithub.com/project-flogo/microgateway " + MicrogatewayVersion + "\n",
+	} {
+		if !strings.Contains(mod, expected) {
+			t.Fatalf("go.mod should contain %s, not %s", expected, mod)
+		}
+	}
+	func() {
+		defer func() {
+			if err := recover(); err == nil || !strings.Contains(fmt.Sprint(err), "doesn't cover github.com/nareshkumarthota/flogocomponents/activity/methodinvoker") {
+				t.Fatalf("a version lock without the method invoker should be rejected, not %v", err)
+			}
+		}()
+		delete(lock, "github.com/nareshkumarthota/flogocomponents")
+		moduleRequires(flogo, support, lock, versions)
+	}()
+
+	err = ioutil.WriteFile(versions, []byte("github.com/project-flogo/core\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("a module without version should be rejected")
+		}
+	}()
+	readVersionLock(versions)
+}
+
+func TestConfig(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	err = ioutil.WriteFile(filepath.Join(tmp, "asyncapi.yml"), []byte(serviceSpec), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(tmp, ConfigFile)
+	err = ioutil.WriteFile(file, []byte(`input: asyncapi.yml
+type: flogodescriptor
+role: client
+output: app
+servers:
+  kafka:
+    role: server
+    url: broker:9092
+    credentials:
+      user: KAFKA_USER
+protocols:
+  mqtt:
+    triggerVersion: v1.2.3
+filters:
+  channels: [light/*]
+features:
+  service: false
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := LoadConfig(file).Merge(Config{Output: "out"}).defaults()
+	if config.Input != filepath.Join(tmp, "asyncapi.yml") || config.Output != "out" || config.Type != "flogodescriptor" {
+		t.Fatalf("invalid config %+v", config)
+	}
+	o := config.options()
+	if credentials := o.credentials("kafka", "kafka"); credentials.User != "KAFKA_USER" || credentials.Password != "PASSWORD" {
+		t.Fatalf("invalid credentials %+v", credentials)
+	}
+	support, flogo := convert(config.Input, o)
+	handlers := getTrigger(t, flogo, "kafkakafka").Handlers
+	if len(handlers) != 1 || handlers[0].Settings["topic"] != "light.on" {
+		t.Fatal("the kafka server should only subscribe to the filtered channel")
+	}
+	for _, trig := range flogo.Triggers {
+		if trig.Id == "mqttmqtt" && len(trig.Handlers) > 0 {
+			t.Fatal("the mqtt client should not subscribe to the channels of the server")
+		}
+	}
+	if !strings.Contains(strings.Join(flogo.Imports, "\n"), "github.com/project-flogo/edge-contrib/trigger/mqtt@v1.2.3") {
+		t.Fatal("the protocol config should set the trigger version")
+	}
+	found := false
+	for _, property := range flogo.Properties {
+		if property.Name() == "kafkakafkaURL" && property.Value() == "broker:9092" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("the server config should set the url")
+	}
+	if strings.Contains(support.String(), "Operations") {
+		t.Fatal("the features should disable the service")
+	}
+
+	err = ioutil.WriteFile(file, []byte("rol: client\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("an unknown field should be rejected")
+		}
+	}()
+	LoadConfig(file)
+}
+
+func TestOverlay(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	input := filepath.Join(tmp, "asyncapi.yml")
+	err = ioutil.WriteFile(input, []byte(serviceSpec), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(tmp, "overlay.yaml")
+	err = ioutil.WriteFile(file, []byte(`overlay: 1.0.0
+info:
+  title: deployment
+  version: 1.0.0
+actions:
+  - target: $.servers.mqtt
+    update:
+      x-keep-alive: 60
+  - target: $.channels['/light/on'].subscribe.message.payload.properties
+    update:
+      level:
+        type: integer
+  - target: $..oneOf[?(@.name == 'removed')]
+    remove: true
+  - target: $.servers.kafka
+    remove: true
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := parse(input, &options{config: Config{Overlays: []string{file}}})
+	if model.Servers["mqtt"].AdditionalProperties["x-keep-alive"] != 60.0 {
+		t.Fatal("the overlay should update the server")
+	}
+	if _, ok := model.Servers["kafka"]; ok {
+		t.Fatal("the overlay should remove the server")
+	}
+	messages := operationMessages(model.Channels.AdditionalProperties["/events"].Subscribe)
+	if len(messages) != 1 || messages[0]["name"] != "created" {
+		t.Fatalf("the overlay should remove the filtered message, not %v", messages)
+	}
+	message := model.Channels.AdditionalProperties["/light/on"].Subscribe.Message.(map[string]interface{})
+	properties := message["payload"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := properties["level"]; !ok || properties["command"] == nil {
+		t.Fatal("the overlay should merge the properties of the payload")
+	}
+
+	for _, target := range []string{"servers", "$.servers[", "$.channels[?(name)]"} {
+		if _, err := parseJSONPath(target); err == nil {
+			t.Fatalf("target %s should be rejected", target)
+		}
+	}
+}
+
+const commandsSpec = `asyncapi: '2.0.0'
+id: 'urn:com:commands:server'
+info:
+  title: Commands
+  version: '1.0.0'
+servers:
+  kafka:
+    url: localhost:9092
+    protocol: kafka
+channels:
+  /light/on:
+    publish:
+      operationId: lightStatus
+      message:
+        name: lightStatus
+        payload:
+          type: object
+          properties:
+            on:
+              type: boolean
+  /commands:
+    subscribe:
+      operationId: command
+      message:
+        payload:
+          type: string
+`
+
+func TestMergeSpecs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	write := func(name, spec string) string {
+		file := filepath.Join(tmp, name)
+		err := ioutil.WriteFile(file, []byte(spec), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	service, commands := write("service.yml", serviceSpec), write("commands.yml", commandsSpec)
+	_, flogo := convert(service+","+commands, options{role: "server"})
+	if flogo.Name != "urn:com:service:server" {
+		t.Fatalf("the first spec should name the application, not %s", flogo.Name)
+	}
+	topics := []string{}
+	for _, handler := range getTrigger(t, flogo, "kafkakafka").Handlers {
+		topics = append(topics, fmt.Sprint(handler.Settings["topic"]))
+	}
+	sort.Strings(topics)
+	if strings.Join(topics, ",") != "commands,events,light.on" {
+		t.Fatalf("the kafka trigger should subscribe to the channels of both specs, not %v", topics)
+	}
+	found := false
+	for _, service := range getGateway(t, flogo, "microgateway:kafkaPublish").Services {
+		if service.Name == "kafka-name-/light/on" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("the channel should get the publish operation of the second spec")
+	}
+	properties := 0
+	for _, property := range flogo.Properties {
+		if property.Name() == "kafkakafkaURL" {
+			properties++
+		}
+	}
+	if properties != 1 {
+		t.Fatalf("the shared server should have one url property, not %d", properties)
+	}
+
+	conflict := write("conflict.yml", strings.Replace(commandsSpec, "localhost:9092", "broker:9092", 1))
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "server kafka of "+conflict+" collides") {
+			t.Fatalf("the servers should collide, not %v", r)
+		}
+	}()
+	convert(service+","+conflict, options{role: "server"})
+}
+
+const gatewaySpec = `asyncapi: '2.0.0'
+id: 'urn:com:gateway:server'
+info:
+  title: Gateway
+  version: '1.0.0'
+servers:
+  api:
+    url: http://localhost:9000
+    protocol: http
+  cluster:
+    url: localhost:9092
+    protocol: kafka
+    x-flogo-role: client
+  public:
+    url: ws://localhost:9001
+    protocol: ws
+  upstream:
+    url: ws://upstream:9002
+    protocol: ws
+    x-flogo-role: client
+channels:
+  /orders:
+    subscribe:
+      message:
+        payload:
+          type: object
+          properties:
+            id:
+              type: string
+`
+
+func TestServerRole(t *testing.T) {
+	_, flogo := convertSpec(t, gatewaySpec, "server")
+	if handlers := getTrigger(t, flogo, "httpapi").Handlers; len(handlers) != 1 {
+		t.Fatal("the http server should receive the orders")
+	}
+	if handlers := getTrigger(t, flogo, "kafkacluster").Handlers; len(handlers) != 0 {
+		t.Fatal("the kafka client should not receive the orders")
+	}
+	found := false
+	for _, service := range getGateway(t, flogo, "microgateway:kafkaPublish").Services {
+		if service.Name == "kafka-name-/orders" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("the kafka client should publish the orders")
+	}
+	if ref := getTrigger(t, flogo, "wspublic").Ref; ref != protocolWebsocket.serverTrigger {
+		t.Fatalf("the websocket server should use the server trigger, not %s", ref)
+	}
+	if ref := getTrigger(t, flogo, "wsupstream").Ref; ref != protocolWebsocket.trigger {
+		t.Fatalf("the websocket client should use the client trigger, not %s", ref)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "asyncapi.yml: server cluster: invalid role all") {
+			t.Fatalf("an invalid role should be rejected, not %v", r)
+		}
+	}()
+	convertSpec(t, strings.Replace(gatewaySpec, "x-flogo-role: client", "x-flogo-role: all", 1), "server")
+}
+
+const loopbackSpec = `asyncapi: '2.0.0'
+id: 'urn:com:loopback:server'
+info:
+  title: Loopback
+  version: '1.0.0'
+servers:
+  local:
+    url: localhost:9092
+    protocol: kafka
+channels:
+  /orders:
+    subscribe:
+      message:
+        payload:
+          type: string
+    publish:
+      message:
+        payload:
+          type: string
+`
+
+func TestLoopback(t *testing.T) {
+	support, flogo := convertSpec(t, loopbackSpec, "both")
+	ids := make(map[string]bool)
+	for _, trig := range flogo.Triggers {
+		if ids[trig.Id] {
+			t.Fatalf("trigger %s is generated twice", trig.Id)
+		}
+		ids[trig.Id] = true
+	}
+	for _, res := range flogo.Resources {
+		if ids[res.ID] {
+			t.Fatalf("resource %s is generated twice", res.ID)
+		}
+		ids[res.ID] = true
+	}
+	for _, id := range []string{"kafkalocal", "kafkaClientlocal"} {
+		if handlers := getTrigger(t, flogo, id).Handlers; len(handlers) != 1 {
+			t.Fatalf("trigger %s should receive the orders", id)
+		}
+	}
+	getGateway(t, flogo, "microgateway:kafka")
+	getGateway(t, flogo, "microgateway:kafkaClient")
+	if port := getTrigger(t, flogo, "kafkaPublish").Settings["port"]; port != defaultPortBase {
+		t.Fatalf("the server bridge should listen on %d, not %v", defaultPortBase, port)
+	}
+	if port := getTrigger(t, flogo, "kafkaClientPublish").Settings["port"]; port != defaultPortBase+loopbackPortOffset {
+		t.Fatalf("the client bridge should listen on %d, not %v", defaultPortBase+loopbackPortOffset, port)
+	}
+	code := support.String()
+	for _, method := range []string{"kafkaMethod", "kafkaClientMethod"} {
+		if !strings.Contains(code, fmt.Sprintf("RegisterMethods(%q", method)) {
+			t.Fatalf("%s should be registered", method)
+		}
+	}
+
+	_, flogo = convertSpec(t, loopbackSpec, "server")
+	for _, trig := range flogo.Triggers {
+		if strings.Contains(trig.Id, "Client") {
+			t.Fatalf("a server should not generate the client trigger %s", trig.Id)
+		}
+	}
+}
+
+const loopbackPortsSpec = `asyncapi: '2.0.0'
+id: 'urn:com:loopback:ports'
+info:
+  title: Loopback ports
+  version: '1.0.0'
+servers:
+  orders:
+    url: http://localhost:9000
+    protocol: http
+  invoices:
+    url: http://localhost:{port}
+    protocol: http
+    variables:
+      port:
+        default: '9100'
+channels:
+  /orders:
+    subscribe:
+      message:
+        payload:
+          type: object
+`
+
+func TestLoopbackPorts(t *testing.T) {
+	_, flogo := convertSpec(t, loopbackPortsSpec, "both")
+	properties := make(map[string]interface{})
+	for _, property := range flogo.Properties {
+		properties[property.Name()] = property.Value()
+	}
+	for id, expected := range map[string]interface{}{
+		"httporders":         "=$property[httpordersPort]",
+		"httpinvoices":       "=string.integer($property[httpinvoices_port])",
+		"httpClientorders":   "=$property[httpClientordersPort]",
+		"httpClientinvoices": "=string.integer($property[httpClientinvoices_port]) + 100",
+	} {
+		if port := getTrigger(t, flogo, id).Settings["port"]; port != expected {
+			t.Fatalf("trigger %s should listen on %v, not %v", id, expected, port)
+		}
+	}
+	// the client side of orders can't take 9100, invoices listens on it
+	if port := properties["httpordersPort"]; port != 9000 {
+		t.Fatalf("orders should listen on 9000, not %v", port)
+	}
+	if port := properties["httpClientordersPort"]; port != 9101 {
+		t.Fatalf("the client side of orders should listen on 9101, not %v", port)
+	}
+
+	defer func() {
+		if err := recover(); err == nil || !strings.Contains(fmt.Sprint(err), "trigger httporders: port 9000 is already used by trigger httpinvoices") {
+			t.Fatalf("servers listening on the same port should be rejected, not %v", err)
+		}
+	}()
+	convertSpec(t, strings.Replace(loopbackPortsSpec, "'9100'", "'9000'", 1), "server")
+}
+
+const mqtt5Spec = `asyncapi: '2.0.0'
+id: 'urn:com:mqtt5:server'
+info:
+  title: MQTT 5
+  version: '1.0.0'
+servers:
+  broker:
+    url: tcp://localhost:1883
+    protocol: mqtt5
+    x-shared-group: workers
+    x-session-expiry: 3600
+channels:
+  /message:
+    subscribe:
+      message:
+        payload:
+          type: string
+      traits:
+        - bindings:
+            flogo-mqtt5:
+              qos: 1
+    publish:
+      message:
+        payload:
+          type: string
+      traits:
+        - bindings:
+            flogo-mqtt5:
+              qos: 2
+              messageExpiryInterval: 60
+`
+
+const mqtt5SharedSpec = `asyncapi: '2.0.0'
+id: 'urn:com:mqtt5:client'
+info:
+  title: MQTT 5
+  version: '1.0.0'
+servers:
+  broker:
+    url: tcp://localhost:1883
+    protocol: mqtt5
+channels:
+  /reading:
+    publish:
+      message:
+        payload:
+          type: number
+      bindings:
+        mqtt5:
+          sharedGroup: analytics
+          qos: 1
+`
+
+func TestMQTT5(t *testing.T) {
+	testProtocol(t, []protocolCase{
+		{
+			name:     "server",
+			spec:     mqtt5Spec,
+			role:     "server",
+			trigger:  "mqtt5broker",
+			ref:      protocolMQTT.trigger,
+			settings: map[string]interface{}{"id": "mqtt5broker", "broker": "=$property[mqtt5brokerURL]"},
+			handler:  map[string]interface{}{"topic": "$share/workers/message", "qos": 1},
+			gateway:  "microgateway:mqtt5Publish",
+			service:  "mqtt5-name-/message",
+			serviceSettings: map[string]interface{}{
+				"broker": "=$property[mqtt5brokerURL]",
+				"topic":  "message",
+				"qos":    2,
+			},
+			warnings: []string{
+				"server broker: the x-session-expiry extension isn't supported by the mqtt5 trigger and activity",
+				"server broker: the messageExpiryInterval binding of channel /message isn't supported",
+			},
+		},
+		{
+			name:    "shared client",
+			spec:    mqtt5SharedSpec,
+			role:    "client",
+			trigger: "mqtt5broker",
+			ref:     protocolMQTT.trigger,
+			handler: map[string]interface{}{"topic": "$share/analytics/reading", "qos": 1},
+			quiet:   true,
+		},
+	})
+}
+
+const kafkaSpec = `asyncapi: '2.0.0'
+id: 'urn:com:kafka:server'
+info:
+  title: Kafka
+  version: '1.0.0'
+servers:
+  cluster:
+    url: localhost:9092
+    protocol: kafka
+channels:
+  /user/signedup:
+    subscribe:
+      bindings:
+        kafka:
+          groupId:
+            type: string
+            enum: ['asyncapi']
+      message:
+        payload:
+          type: string
+      traits:
+        - bindings:
+            flogo-kafka:
+              partitions: "0,1"
+              offset: 5
+`
+
+const kafkaSecureSpec = `asyncapi: '2.0.0'
+id: 'urn:com:kafka:client'
+info:
+  title: Kafka
+  version: '1.0.0'
+servers:
+  cluster:
+    url: localhost:9093
+    protocol: kafka-secure
+    security:
+      - user: []
+      - cert: []
+channels:
+  /user/signedup:
+    subscribe:
+      message:
+        bindings:
+          kafka:
+            key:
+              type: string
+        payload:
+          type: string
+components:
+  securitySchemes:
+    user:
+      type: userPassword
+    cert:
+      type: X509
+`
+
+func TestKafka(t *testing.T) {
+	testProtocol(t, []protocolCase{
+		{
+			name:     "consumer",
+			spec:     kafkaSpec,
+			role:     "server",
+			trigger:  "kafkacluster",
+			ref:      protocolKafka.trigger,
+			settings: map[string]interface{}{"brokerUrls": "=$property[kafkaclusterURL]"},
+			handler:  map[string]interface{}{"topic": "user.signedup", "partitions": "0,1", "offset": 5},
+			warnings: []string{"server cluster: the groupId binding of channel /user/signedup isn't supported by the kafka trigger and activity"},
+		},
+		{
+			name:    "secure producer",
+			spec:    kafkaSecureSpec,
+			role:    "client",
+			trigger: "kafkacluster",
+			settings: map[string]interface{}{
+				"brokerUrls": "=$property[kafkaclusterURL]",
+				"user":       "=$env[USER]",
+				"password":   "=$env[PASSWORD]",
+				"trustStore": "=$env[TRUST_STORE]",
+			},
+			gateway: "microgateway:kafkaPublish",
+			service: "kafka-name-/user/signedup",
+			serviceSettings: map[string]interface{}{
+				"brokerUrls": "=$property[kafkaclusterURL]",
+				"topic":      "user.signedup",
+				"user":       "=$env[USER]",
+				"password":   "=$env[PASSWORD]",
+				"trustStore": "=$env[TRUST_STORE]",
+			},
+			warnings: []string{
+				"server cluster: the x509 client certificate isn't supported",
+				"server cluster: the message key binding of channel /user/signedup isn't supported",
+			},
+		},
+	})
+}
+
+const httpSpec = `asyncapi: '2.0.0'
+id: 'urn:com:http:server'
+info:
+  title: HTTP
+  version: '1.0.0'
+servers:
+  api:
+    url: http://localhost:9000
+    protocol: http
+channels:
+  /users:
+    subscribe:
+      bindings:
+        http:
+          type: request
+          method: GET
+          query:
+            type: object
+            required: [limit]
+            properties:
+              limit:
+                type: integer
+              tags:
+                type: array
+                items:
+                  type: string
+                  enum: [a, b]
+              filter:
+                type: object
+      traits:
+        - bindings:
+            flogo-http:
+              statusCode: 201
+      message:
+        payload:
+          type: object
+  /events:
+    subscribe:
+      message:
+        payload:
+          type: object
+`
+
+func TestHTTP(t *testing.T) {
+	support, flogo := convertSpec(t, httpSpec, "server")
+	methods, async := make(map[string]interface{}), make(map[string]interface{})
+	for _, handler := range getTrigger(t, flogo, "httpapi").Handlers {
+		path := handler.Settings["path"].(string)
+		methods[path], async[path] = handler.Settings["method"], handler.Actions[0].Settings["async"]
+	}
+	if methods["/users"] != "GET" || methods["/events"] != "POST" {
+		t.Fatalf("invalid http methods %v", methods)
+	}
+	if async["/users"] != false || async["/events"] != true {
+		t.Fatalf("only the requests should be answered synchronously %v", async)
+	}
+	found := false
+	for _, response := range getGateway(t, flogo, "microgateway:http").Responses {
+		if !response.Error && fmt.Sprint(response.Output.Code) == "201" && strings.Contains(response.Condition, "'/users'") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("the requests of /users should be answered with 201")
+	}
+	code := support.String()
+	for _, expected := range []string{
+		`"limit": {typ: "integer", items: "", required: true, enum: []string(nil)},`,
+		`"tags": {typ: "array", items: "string", required: false, enum: []string{"a", "b"}},`,
+		`"filter": {typ: "object", items: "", required: false, enum: []string(nil)},`,
+		"func httpValidate(",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Fatalf("support code should contain %s", expected)
+		}
+	}
+}
+
+const websocketSpec = `asyncapi: '2.0.0'
+id: 'urn:com:websocket:client'
+info:
+  title: Websocket
+  version: '1.0.0'
+servers:
+  upstream:
+    url: wss://upstream:9002/feed
+    protocol: wss
+    x-skip-verify: false
+    x-use-systemcert: false
+channels:
+  /prices:
+    bindings:
+      ws:
+        headers:
+          type: object
+          properties:
+            x-token:
+              type: string
+              enum: [secret]
+        query:
+          type: object
+          properties:
+            currency:
+              type: string
+              enum: [EUR]
+    subscribe:
+      message:
+        payload:
+          type: number
+    publish:
+      message:
+        payload:
+          type: number
+`
+
+const websocketServerSpec = `asyncapi: '2.0.0'
+id: 'urn:com:websocket:server'
+info:
+  title: Websocket Server
+  version: '1.0.0'
+servers:
+  public:
+    url: wss://localhost:9443/ws
+    protocol: wss
+channels:
+  /rooms/{room}:
+    parameters:
+      room:
+        schema:
+          type: string
+    subscribe:
+      message:
+        payload:
+          type: string
+    publish:
+      message:
+        payload:
+          type: string
+`
+
+// websocketServerSettings are the settings of the wsserver trigger and its handlers in the pinned websocket module
+var websocketServerSettings = map[string][]string{
+	"trigger": {"port", "enableTLS", "certFile", "keyFile"},
+	"handler": {"method", "path"},
+}
+
+func TestWebsocket(t *testing.T) {
+	testProtocol(t, []protocolCase{
+		{
+			name:    "secure client",
+			spec:    websocketSpec,
+			role:    "client",
+			trigger: "wsupstream",
+			ref:     protocolWebsocket.trigger,
+			settings: map[string]interface{}{
+				"url":           "=$property[wsupstreamURL]",
+				"allowInsecure": false,
+				"caCert":        "=$env[TRUST_STORE]",
+			},
+			handler: map[string]interface{}{"path": "/prices?currency=EUR"},
+			gateway: "microgateway:wsPublish",
+			service: "ws-name-/prices",
+			serviceSettings: map[string]interface{}{
+				"uri":           "=string.concat($property[wsupstreamURL], '/prices?currency=EUR')",
+				"allowInsecure": false,
+				"caCert":        "=$env[TRUST_STORE]",
+			},
+			warnings: []string{"server upstream: the headers of the ws binding of channel /prices isn't supported by the ws trigger and activity"},
+		},
+		{
+			name:    "server",
+			spec:    websocketServerSpec,
+			role:    "server",
+			trigger: "wspublic",
+			ref:     protocolWebsocket.serverTrigger,
+			settings: map[string]interface{}{
+				"port":      "=$property[wspublicPort]",
+				"enableTLS": true,
+				"certFile":  "=$env[CERT_FILE]",
+				"keyFile":   "=$env[KEY_FILE]",
+			},
+			handler:  map[string]interface{}{"method": "GET", "path": "/ws/rooms/:room"},
+			input:    map[string]interface{}{"connection": "=$.wsconnection", "params": "=$.pathParams"},
+			warnings: []string{"server public: the publish operation of channel /rooms/{room} isn't supported by the ws trigger and activity"},
+			accepted: websocketServerSettings,
+		},
+	})
+}
@@ -0,0 +1,309 @@
+package transform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type chunk struct {
+	name  string
+	value string
+}
+
+// parseURL splits a template into literal and variable chunks
+func parseURL(url string) ([]chunk, bool) {
+	var (
+		chunks      []chunk
+		parsed      []rune
+		hasVariable bool
+	)
+	for _, s := range url {
+		switch s {
+		case '{':
+			if len(parsed) > 0 {
+				chunks, parsed = append(chunks, chunk{value: string(parsed)}), parsed[:0]
+			}
+		case '}':
+			if len(parsed) > 0 {
+				chunks, parsed = append(chunks, chunk{name: string(parsed)}), parsed[:0]
+				hasVariable = true
+			}
+		default:
+			parsed = append(parsed, s)
+		}
+	}
+	if len(parsed) > 0 {
+		chunks, parsed = append(chunks, chunk{value: string(parsed)}), parsed[:0]
+	}
+	return chunks, hasVariable
+}
+
+// hasVariable returns true if any of the chunks is a variable
+func hasVariable(chunks []chunk) bool {
+	for _, chunk := range chunks {
+		if chunk.name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// concat renders chunks as a flogo expression, resolving variables with property
+func concat(chunks []chunk, property func(name string) string) string {
+	if len(chunks) == 1 && chunks[0].name != "" {
+		return property(chunks[0].name)
+	}
+	expression, comma := "string.concat(", ""
+	for _, chunk := range chunks {
+		if chunk.name != "" {
+			expression += fmt.Sprintf("%s%s", comma, property(chunk.name))
+		} else {
+			expression += fmt.Sprintf("%s'%s'", comma, chunk.value)
+		}
+		comma = ", "
+	}
+	return expression + ")"
+}
+
+// expand replaces the variables of the chunks with their values
+func expand(chunks []chunk, value func(name string) string) string {
+	expanded := ""
+	for _, chunk := range chunks {
+		if chunk.name != "" {
+			expanded += value(chunk.name)
+		} else {
+			expanded += chunk.value
+		}
+	}
+	return expanded
+}
+
+// colonPath converts the variables of a channel into colon prefixed path parameters
+func colonPath(topic string) string {
+	chunks, hasVariables := parseURL(topic)
+	if !hasVariables {
+		return topic
+	}
+	translated := ""
+	for _, chunk := range chunks {
+		if chunk.value != "" {
+			translated += chunk.value
+		} else {
+			translated += ":" + chunk.name
+		}
+	}
+	return translated
+}
+
+// hostPort is a host and an optional port of a server url
+type hostPort struct {
+	host []chunk
+	port []chunk
+}
+
+// serverURL is a server url template broken into its components
+type serverURL struct {
+	raw      string
+	chunks   []chunk
+	scheme   []chunk
+	userinfo []chunk
+	hosts    []hostPort
+	path     []chunk
+}
+
+// urlError is a diagnostic for a malformed server url
+type urlError struct {
+	url    string
+	offset int
+	reason string
+}
+
+func (e *urlError) Error() string {
+	if e.offset < 0 {
+		return fmt.Sprintf("malformed url %q: %s", e.url, e.reason)
+	}
+	return fmt.Sprintf("malformed url %q at offset %d: %s", e.url, e.offset, e.reason)
+}
+
+// indexOutside returns the index of the first separator in s that isn't inside of a variable
+func indexOutside(s, separators string) int {
+	depth := 0
+	for i, r := range s {
+		switch {
+		case r == '{':
+			depth++
+		case r == '}':
+			depth--
+		case depth == 0 && strings.ContainsRune(separators, r):
+			return i
+		}
+	}
+	return -1
+}
+
+// lastIndexOutside returns the index of the last separator in s that isn't inside of a variable
+func lastIndexOutside(s, separators string) int {
+	depth, index := 0, -1
+	for i, r := range s {
+		switch {
+		case r == '{':
+			depth++
+		case r == '}':
+			depth--
+		case depth == 0 && strings.ContainsRune(separators, r):
+			index = i
+		}
+	}
+	return index
+}
+
+// parseServerURL parses a server url template into scheme, userinfo, hosts and path
+func parseServerURL(url string) (*serverURL, error) {
+	fail := func(offset int, format string, a ...interface{}) (*serverURL, error) {
+		return nil, &urlError{
+			url:    url,
+			offset: offset,
+			reason: fmt.Sprintf(format, a...),
+		}
+	}
+
+	if strings.TrimSpace(url) == "" {
+		return fail(-1, "url is empty")
+	}
+	start := -1
+	for i, r := range url {
+		switch r {
+		case '{':
+			if start >= 0 {
+				return fail(i, "nested variable")
+			}
+			start = i
+		case '}':
+			if start < 0 {
+				return fail(i, "unexpected '}'")
+			}
+			if start == i-1 {
+				return fail(start, "empty variable")
+			}
+			start = -1
+		}
+	}
+	if start >= 0 {
+		return fail(start, "unterminated variable")
+	}
+
+	parsed := &serverURL{
+		raw: url,
+	}
+	parsed.chunks, _ = parseURL(url)
+
+	offset, rest := 0, url
+	if i := strings.Index(rest, "://"); i >= 0 && indexOutside(rest[:i+1], ":") == i {
+		if i == 0 {
+			return fail(0, "empty scheme")
+		}
+		parsed.scheme, _ = parseURL(rest[:i])
+		offset, rest = i+3, rest[i+3:]
+	}
+
+	authority := rest
+	if i := indexOutside(rest, "/?#"); i >= 0 {
+		authority = rest[:i]
+		parsed.path, _ = parseURL(rest[i:])
+	}
+	if i := lastIndexOutside(authority, "@"); i >= 0 {
+		parsed.userinfo, _ = parseURL(authority[:i])
+		offset, authority = offset+i+1, authority[i+1:]
+	}
+	if authority == "" {
+		return fail(offset, "missing host")
+	}
+
+	for authority != "" {
+		host := authority
+		next := indexOutside(authority, ",")
+		if next >= 0 {
+			host = authority[:next]
+		}
+		trimmed := strings.TrimLeft(host, " ")
+		at := offset + len(host) - len(trimmed)
+		host = strings.TrimRight(trimmed, " ")
+		if host == "" {
+			return fail(at, "empty host")
+		}
+
+		entry, port, portAt := hostPort{}, "", -1
+		if strings.HasPrefix(host, "[") {
+			end := strings.Index(host, "]")
+			if end < 0 {
+				return fail(at, "unterminated IPv6 literal")
+			}
+			entry.host, _ = parseURL(host[:end+1])
+			if remainder := host[end+1:]; remainder != "" {
+				if remainder[0] != ':' {
+					return fail(at+end+1, "unexpected %q after IPv6 literal", remainder)
+				}
+				port, portAt = remainder[1:], at+end+2
+			}
+		} else if i := lastIndexOutside(host, ":"); i >= 0 {
+			if indexOutside(host, ":") != i {
+				return fail(at, "IPv6 literal %q must be enclosed in brackets", host)
+			}
+			if i == 0 {
+				return fail(at, "missing host before port")
+			}
+			entry.host, _ = parseURL(host[:i])
+			port, portAt = host[i+1:], at+i+1
+		} else {
+			entry.host, _ = parseURL(host)
+		}
+
+		if portAt >= 0 {
+			if port == "" {
+				return fail(portAt, "empty port")
+			}
+			chunks, hasVariable := parseURL(port)
+			if !hasVariable {
+				value, err := strconv.Atoi(port)
+				if err != nil {
+					return fail(portAt, "port %q is not a number", port)
+				}
+				if value < 1 || value > 65535 {
+					return fail(portAt, "port %d is out of range", value)
+				}
+			}
+			entry.port = chunks
+		}
+		parsed.hosts = append(parsed.hosts, entry)
+
+		if next < 0 {
+			break
+		}
+		offset, authority = offset+next+1, authority[next+1:]
+		if authority == "" {
+			return fail(offset, "empty host")
+		}
+	}
+
+	return parsed, nil
+}
+
+// variables returns the names of the variables used in the url
+func (u *serverURL) variables() []string {
+	var names []string
+	for _, chunk := range u.chunks {
+		if chunk.name != "" {
+			names = append(names, chunk.name)
+		}
+	}
+	return names
+}
+
+// port returns the port of the first host
+func (u *serverURL) port() []chunk {
+	if len(u.hosts) == 0 {
+		return nil
+	}
+	return u.hosts[0].port
+}